@@ -13,6 +13,10 @@ type Config struct {
 	Database DatabaseConfig `yaml:"database"`
 	Redis    RedisConfig    `yaml:"redis"`
 	JWT      JWTConfig      `yaml:"jwt"`
+	Seckill  SeckillConfig  `yaml:"seckill"`
+	Admin    AdminConfig    `yaml:"admin"`
+	Payment  PaymentConfig  `yaml:"payment"`
+	Cache    CacheConfig    `yaml:"cache"`
 }
 
 // ServerConfig 服务器配置
@@ -45,6 +49,97 @@ type JWTConfig struct {
 	ExpireTime int    `yaml:"expire_time"`
 }
 
+// SeckillConfig 秒杀配置
+type SeckillConfig struct {
+	MaxDeliveryAttempts int             `yaml:"max_delivery_attempts"` // 订单消息投递次数告警阈值，瞬时错误超过后继续退避重试，无法创建的订单直接转入死信队列
+	ClaimMinIdle        int             `yaml:"claim_min_idle"`        // pending消息空闲超过该时间（秒）后可被其他消费者认领
+	ClaimInterval       int             `yaml:"claim_interval"`        // 认领pending消息的扫描间隔（秒）
+	ReconcileInterval   int             `yaml:"reconcile_interval"`    // Redis与MySQL对账间隔（秒），小于0表示不启动后台对账
+	ReconcileRepair     bool            `yaml:"reconcile_repair"`      // 后台对账发现不一致时是否自动用MySQL修复Redis
+	PayTimeout          int             `yaml:"pay_timeout"`           // 秒杀订单支付超时时间（秒），超时未支付自动取消
+	RateLimit           RateLimitConfig `yaml:"rate_limit"`            // 秒杀接口限流
+	Queue               QueueConfig     `yaml:"queue"`                 // 排队秒杀配置
+}
+
+// QueueConfig 排队秒杀配置，开启排队的秒杀券需要先领取排队号，按批次放行后获得限时购买许可
+type QueueConfig struct {
+	AdmitBatch    int `yaml:"admit_batch"`    // 每张秒杀券每批放行的人数
+	AdmitInterval int `yaml:"admit_interval"` // 放行间隔（秒）
+	PermitTTL     int `yaml:"permit_ttl"`     // 购买许可有效期（秒）
+}
+
+// TokenBucketConfig 令牌桶配置
+type TokenBucketConfig struct {
+	Rate  float64 `yaml:"rate"`  // 每秒生成的令牌数，小于0表示不限流
+	Burst int     `yaml:"burst"` // 桶容量，即允许的突发请求数
+}
+
+// RateLimitRule 秒杀限流规则
+type RateLimitRule struct {
+	User    TokenBucketConfig `yaml:"user"`    // 单个用户对单张秒杀券的请求限流
+	Voucher TokenBucketConfig `yaml:"voucher"` // 单张秒杀券的总请求限流
+}
+
+// RateLimitConfig 秒杀限流配置
+type RateLimitConfig struct {
+	RateLimitRule `yaml:",inline"`
+	Vouchers      map[uint]RateLimitRule `yaml:"vouchers"` // 按秒杀券ID覆盖默认规则，未配置的项使用默认值
+}
+
+// ForVoucher 获取秒杀券生效的限流规则
+func (r RateLimitConfig) ForVoucher(voucherID uint) RateLimitRule {
+	rule := r.RateLimitRule
+	if override, ok := r.Vouchers[voucherID]; ok {
+		if override.User.Rate != 0 {
+			rule.User = override.User
+		}
+		if override.Voucher.Rate != 0 {
+			rule.Voucher = override.Voucher
+		}
+	}
+	return rule
+}
+
+// AdminConfig 管理员配置
+type AdminConfig struct {
+	UserIDs []uint `yaml:"user_ids"` // 拥有管理权限的用户ID
+}
+
+// IsAdmin 判断用户是否为管理员
+func (a AdminConfig) IsAdmin(userID uint) bool {
+	for _, id := range a.UserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// PaymentConfig 支付配置
+type PaymentConfig struct {
+	Provider    string `yaml:"provider"`     // 使用的支付渠道，默认为内置的模拟支付 mock，需同时开启 mock_enabled
+	Secret      string `yaml:"secret"`       // 支付回调签名密钥，必须单独配置，不能与其他密钥共用
+	CallbackURL string `yaml:"callback_url"` // 支付结果回调地址
+	MockDelay   int    `yaml:"mock_delay"`   // 模拟支付发起回调前的等待时间（秒）
+	MockEnabled bool   `yaml:"mock_enabled"` // 是否启用模拟支付，仅用于开发和测试，默认关闭
+}
+
+// CacheConfig 缓存配置
+type CacheConfig struct {
+	HotShopIDs []uint `yaml:"hot_shop_ids"` // 热点商铺ID，使用逻辑过期缓存
+	HotShopTTL int    `yaml:"hot_shop_ttl"` // 热点商铺缓存的逻辑过期时间（秒）
+}
+
+// IsHotShop 判断商铺是否为热点商铺
+func (c CacheConfig) IsHotShop(shopID uint) bool {
+	for _, id := range c.HotShopIDs {
+		if id == shopID {
+			return true
+		}
+	}
+	return false
+}
+
 var globalConfig *Config
 
 // LoadConfig 加载配置文件
@@ -64,6 +159,10 @@ func LoadConfigFromFile(configPath string) error {
 		return fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	config.applyDefaults()
+	if err := config.validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
 	globalConfig = &config
 	log.Printf("Configuration loaded successfully from: %s", configPath)
 	return nil
@@ -72,4 +171,66 @@ func LoadConfigFromFile(configPath string) error {
 // GetConfig 获取全局配置
 func GetConfig() *Config {
 	return globalConfig
-}
\ No newline at end of file
+}
+
+// applyDefaults 为未配置的选项设置默认值
+func (c *Config) applyDefaults() {
+	if c.Seckill.MaxDeliveryAttempts <= 0 {
+		c.Seckill.MaxDeliveryAttempts = 5
+	}
+	if c.Seckill.ClaimMinIdle <= 0 {
+		c.Seckill.ClaimMinIdle = 60
+	}
+	if c.Seckill.ClaimInterval <= 0 {
+		c.Seckill.ClaimInterval = 30
+	}
+	if c.Seckill.ReconcileInterval == 0 {
+		c.Seckill.ReconcileInterval = 300
+	}
+	if c.Seckill.PayTimeout <= 0 {
+		c.Seckill.PayTimeout = 900
+	}
+	if c.Seckill.RateLimit.User.Rate == 0 {
+		c.Seckill.RateLimit.User = TokenBucketConfig{Rate: 1, Burst: 3}
+	}
+	if c.Seckill.RateLimit.Voucher.Rate == 0 {
+		c.Seckill.RateLimit.Voucher = TokenBucketConfig{Rate: 2000, Burst: 5000}
+	}
+	if c.Seckill.Queue.AdmitBatch <= 0 {
+		c.Seckill.Queue.AdmitBatch = 100
+	}
+	if c.Seckill.Queue.AdmitInterval <= 0 {
+		c.Seckill.Queue.AdmitInterval = 1
+	}
+	if c.Seckill.Queue.PermitTTL <= 0 {
+		c.Seckill.Queue.PermitTTL = 60
+	}
+	if c.Payment.Provider == "" {
+		c.Payment.Provider = "mock"
+	}
+	if c.Payment.CallbackURL == "" {
+		port := c.Server.Port
+		if port == "" {
+			port = "8080"
+		}
+		c.Payment.CallbackURL = "http://127.0.0.1:" + port + "/api/pay/callback/" + c.Payment.Provider
+	}
+	if c.Payment.MockDelay <= 0 {
+		c.Payment.MockDelay = 2
+	}
+	if c.Cache.HotShopTTL <= 0 {
+		c.Cache.HotShopTTL = 1800
+	}
+}
+
+// validate 校验无法使用默认值的必填配置
+func (c *Config) validate() error {
+	// 回调签名密钥为空时任何人都能伪造支付成功通知
+	if c.Payment.Provider != "mock" && c.Payment.Secret == "" {
+		return fmt.Errorf("payment.secret is required when payment provider %q is enabled", c.Payment.Provider)
+	}
+	if c.Payment.MockEnabled && c.Payment.Secret == "" {
+		return fmt.Errorf("payment.secret is required when payment.mock_enabled is set")
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package config
+
+import "testing"
+
+func TestValidatePaymentSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		payment PaymentConfig
+		wantErr bool
+	}{
+		{"默认模拟渠道未启用，无需密钥", PaymentConfig{Provider: "mock"}, false},
+		{"启用模拟支付但未配置密钥", PaymentConfig{Provider: "mock", MockEnabled: true}, true},
+		{"启用模拟支付并配置密钥", PaymentConfig{Provider: "mock", MockEnabled: true, Secret: "s"}, false},
+		{"真实渠道未配置密钥", PaymentConfig{Provider: "alipay"}, true},
+		{"真实渠道配置密钥", PaymentConfig{Provider: "alipay", Secret: "s"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{Payment: tt.payment}
+			err := c.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateDoesNotReuseJWTSecret(t *testing.T) {
+	c := &Config{
+		JWT:     JWTConfig{Secret: "jwt-secret"},
+		Payment: PaymentConfig{Provider: "mock", MockEnabled: true},
+	}
+	c.applyDefaults()
+	if err := c.validate(); err == nil {
+		t.Fatal("仅配置JWT密钥时应要求单独配置支付密钥")
+	}
+	if c.Payment.Secret != "" {
+		t.Errorf("支付密钥不应回退为JWT密钥，实际为 %q", c.Payment.Secret)
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	t.Run("未配置时使用默认值", func(t *testing.T) {
+		c := &Config{}
+		c.applyDefaults()
+
+		if c.Seckill.MaxDeliveryAttempts != 5 {
+			t.Errorf("MaxDeliveryAttempts = %d, want 5", c.Seckill.MaxDeliveryAttempts)
+		}
+		if c.Seckill.ClaimMinIdle != 60 || c.Seckill.ClaimInterval != 30 {
+			t.Errorf("ClaimMinIdle/ClaimInterval = %d/%d, want 60/30", c.Seckill.ClaimMinIdle, c.Seckill.ClaimInterval)
+		}
+		if c.Seckill.ReconcileInterval != 300 {
+			t.Errorf("ReconcileInterval = %d, want 300", c.Seckill.ReconcileInterval)
+		}
+		if c.Seckill.PayTimeout != 900 {
+			t.Errorf("PayTimeout = %d, want 900", c.Seckill.PayTimeout)
+		}
+		if c.Payment.Provider != "mock" || c.Payment.MockEnabled {
+			t.Errorf("Payment = %+v, want provider mock and mock disabled", c.Payment)
+		}
+		if c.Payment.CallbackURL != "http://127.0.0.1:8080/api/pay/callback/mock" {
+			t.Errorf("CallbackURL = %q", c.Payment.CallbackURL)
+		}
+	})
+
+	t.Run("保留已配置的值", func(t *testing.T) {
+		c := &Config{
+			Server: ServerConfig{Port: "9090"},
+			Seckill: SeckillConfig{
+				MaxDeliveryAttempts: 8,
+				ReconcileInterval:   -1,
+				PayTimeout:          60,
+			},
+			Payment: PaymentConfig{Provider: "alipay"},
+		}
+		c.applyDefaults()
+
+		if c.Seckill.MaxDeliveryAttempts != 8 {
+			t.Errorf("MaxDeliveryAttempts = %d, want 8", c.Seckill.MaxDeliveryAttempts)
+		}
+		// 小于0表示不启动后台对账，不能被默认值覆盖
+		if c.Seckill.ReconcileInterval != -1 {
+			t.Errorf("ReconcileInterval = %d, want -1", c.Seckill.ReconcileInterval)
+		}
+		if c.Seckill.PayTimeout != 60 {
+			t.Errorf("PayTimeout = %d, want 60", c.Seckill.PayTimeout)
+		}
+		if c.Payment.CallbackURL != "http://127.0.0.1:9090/api/pay/callback/alipay" {
+			t.Errorf("CallbackURL = %q", c.Payment.CallbackURL)
+		}
+	})
+}
+
+func TestRateLimitConfigForVoucher(t *testing.T) {
+	defaults := RateLimitRule{
+		User:    TokenBucketConfig{Rate: 1, Burst: 3},
+		Voucher: TokenBucketConfig{Rate: 2000, Burst: 5000},
+	}
+	cfg := RateLimitConfig{
+		RateLimitRule: defaults,
+		Vouchers: map[uint]RateLimitRule{
+			1: {User: TokenBucketConfig{Rate: 5, Burst: 10}},
+			2: {Voucher: TokenBucketConfig{Rate: 100, Burst: 200}},
+			3: {User: TokenBucketConfig{Rate: -1}, Voucher: TokenBucketConfig{Rate: -1}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		voucherID uint
+		want      RateLimitRule
+	}{
+		{"未配置覆盖规则使用默认值", 99, defaults},
+		{"只覆盖用户限流", 1, RateLimitRule{User: TokenBucketConfig{Rate: 5, Burst: 10}, Voucher: defaults.Voucher}},
+		{"只覆盖秒杀券限流", 2, RateLimitRule{User: defaults.User, Voucher: TokenBucketConfig{Rate: 100, Burst: 200}}},
+		{"覆盖为不限流", 3, RateLimitRule{User: TokenBucketConfig{Rate: -1}, Voucher: TokenBucketConfig{Rate: -1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.ForVoucher(tt.voucherID); got != tt.want {
+				t.Errorf("ForVoucher(%d) = %+v, want %+v", tt.voucherID, got, tt.want)
+			}
+		})
+	}
+}
@@ -112,6 +112,7 @@ const (
 	// 博客点赞集合的键名格式：blog_like:%d
 	blogLikeKey = "blog:liked:"
 	feedKey     = "feed:"
+	BlogCache   = "cache:blog:" // 博客详情缓存
 )
 
 // // IsLikedMember 检查用户是否已经点赞博客
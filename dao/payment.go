@@ -0,0 +1,86 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ======== 支付会话缓存 =========
+const (
+	PaymentSessionKey  = "pay:session:"  // 支付会话（string: paymentNo -> 会话JSON）
+	OrderPaymentKey    = "pay:order:"    // 订单当前有效的支付流水号（string: orderId -> paymentNo）
+	PaymentNotifiedKey = "pay:notified:" // 已处理的支付通知，用于回调幂等
+	PaymentNotifiedTTL = 7 * 24 * time.Hour
+	// PaymentSessionGrace 支付会话过期后继续保留的时间，用于校验支付渠道延迟到达的回调
+	PaymentSessionGrace = 24 * time.Hour
+)
+
+// PaymentSession 支付会话
+type PaymentSession struct {
+	PaymentNo string    `json:"paymentNo"`
+	Provider  string    `json:"provider"`
+	OrderID   uint      `json:"orderId,string"`
+	UserID    uint      `json:"userId"`
+	Amount    int64     `json:"amount"`
+	ExpireAt  time.Time `json:"expireAt"`
+}
+
+// SetPaymentSession 保存支付会话，并记录为订单当前有效的支付会话
+// 订单当前会话在 ttl 后失效，会话本身多保留 PaymentSessionGrace，过期后到达的回调仍能找到会话
+func SetPaymentSession(ctx context.Context, rds *redis.Client, session *PaymentSession, ttl time.Duration) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	pipe := rds.TxPipeline()
+	pipe.Set(ctx, PaymentSessionKey+session.PaymentNo, data, ttl+PaymentSessionGrace)
+	pipe.Set(ctx, OrderPaymentKey+strconv.FormatUint(uint64(session.OrderID), 10), session.PaymentNo, ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// GetPaymentSession 获取支付会话（包括已过支付截止时间、仍在保留期内的会话），会话不存在时返回 nil, nil
+func GetPaymentSession(ctx context.Context, rds *redis.Client, paymentNo string) (*PaymentSession, error) {
+	data, err := rds.Get(ctx, PaymentSessionKey+paymentNo).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var session PaymentSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetOrderPaymentSession 获取订单当前有效的支付会话，不存在时返回 nil, nil
+func GetOrderPaymentSession(ctx context.Context, rds *redis.Client, orderID uint) (*PaymentSession, error) {
+	paymentNo, err := rds.Get(ctx, OrderPaymentKey+strconv.FormatUint(uint64(orderID), 10)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return GetPaymentSession(ctx, rds, paymentNo)
+}
+
+// IsPaymentNotified 判断支付通知是否已处理
+func IsPaymentNotified(ctx context.Context, rds *redis.Client, paymentNo string) (bool, error) {
+	n, err := rds.Exists(ctx, PaymentNotifiedKey+paymentNo).Result()
+	return n > 0, err
+}
+
+// MarkPaymentNotified 标记支付通知已处理
+func MarkPaymentNotified(ctx context.Context, rds *redis.Client, paymentNo string) error {
+	return rds.Set(ctx, PaymentNotifiedKey+paymentNo, 1, PaymentNotifiedTTL).Err()
+}
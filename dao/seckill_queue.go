@@ -0,0 +1,87 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ============== 秒杀排队相关缓存设计 =================
+const (
+	SeckillQueueKey         = "seckill:queue:"         // 排队队列（zset: userId -> 排队序号）
+	SeckillQueueSeqKey      = "seckill:queue:seq:"     // 排队序号生成器
+	SeckillQueueVouchersKey = "seckill:queue:vouchers" // 存在排队用户的秒杀券ID集合
+	SeckillPermitKey        = "seckill:permit:"        // 购买许可（voucherId:userId），与 script/seckill.lua 保持一致
+)
+
+// seckillPermitKey 用户对某张秒杀券的购买许可key
+func seckillPermitKey(voucherID, userID uint) string {
+	return fmt.Sprintf("%s%d:%d", SeckillPermitKey, voucherID, userID)
+}
+
+// AddSeckillQueueTicket 用户加入秒杀券排队队列，已在队列中时保持原来的排队位置
+func AddSeckillQueueTicket(ctx context.Context, rds *redis.Client, voucherID, userID uint) error {
+	id := strconv.Itoa(int(voucherID))
+	seq, err := rds.Incr(ctx, SeckillQueueSeqKey+id).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := rds.TxPipeline()
+	pipe.ZAddNX(ctx, SeckillQueueKey+id, &redis.Z{Score: float64(seq), Member: userID})
+	pipe.SAdd(ctx, SeckillQueueVouchersKey, voucherID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// GetSeckillQueueRank 获取用户在排队队列中的位置（从0开始），不在队列中时返回 -1
+func GetSeckillQueueRank(ctx context.Context, rds *redis.Client, voucherID, userID uint) (int64, error) {
+	rank, err := rds.ZRank(ctx, SeckillQueueKey+strconv.Itoa(int(voucherID)), strconv.Itoa(int(userID))).Result()
+	if errors.Is(err, redis.Nil) {
+		return -1, nil
+	}
+	return rank, err
+}
+
+// GetSeckillPermitTTL 获取用户购买许可的剩余有效期，没有许可时返回0
+func GetSeckillPermitTTL(ctx context.Context, rds *redis.Client, voucherID, userID uint) (time.Duration, error) {
+	ttl, err := rds.PTTL(ctx, seckillPermitKey(voucherID, userID)).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// GetSeckillQueueVouchers 获取存在排队用户的秒杀券ID
+func GetSeckillQueueVouchers(ctx context.Context, rds *redis.Client) ([]uint, error) {
+	members, err := rds.SMembers(ctx, SeckillQueueVouchersKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(members))
+	for _, member := range members {
+		id, err := strconv.ParseUint(member, 10, 32)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// DelSeckillQueue 删除秒杀券的排队队列和排队序号
+func DelSeckillQueue(ctx context.Context, rds *redis.Client, voucherID uint) error {
+	id := strconv.Itoa(int(voucherID))
+	pipe := rds.TxPipeline()
+	pipe.Del(ctx, SeckillQueueKey+id, SeckillQueueSeqKey+id)
+	pipe.SRem(ctx, SeckillQueueVouchersKey, voucherID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
@@ -3,6 +3,7 @@ package dao
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"hm-dianping-go/models"
 	"strconv"
 	"time"
@@ -31,14 +32,37 @@ func UpdateSeckillVoucher(seckillVoucher *models.SeckillVoucher) error {
 	return DB.Save(seckillVoucher).Error
 }
 
-// DeleteSeckillVoucher 删除秒杀券
-func DeleteSeckillVoucher(voucherID uint) error {
-	return DB.Where("voucher_id = ?", voucherID).Delete(&models.SeckillVoucher{}).Error
+// DeleteSeckillVoucher 删除秒杀券，可传入事务
+func DeleteSeckillVoucher(ctx context.Context, db *gorm.DB, voucherID uint) error {
+	return db.WithContext(ctx).Where("voucher_id = ?", voucherID).Delete(&models.SeckillVoucher{}).Error
 }
 
-// UpdateSeckillVoucherStock 更新秒杀券库存（原子操作）
-func UpdateSeckillVoucherStock(voucherID uint, stock int) error {
-	result := DB.Model(&models.SeckillVoucher{}).
+// UpdateSeckillVoucherTime 更新秒杀券的开始和结束时间，可传入事务
+func UpdateSeckillVoucherTime(ctx context.Context, db *gorm.DB, voucherID uint, beginTime, endTime time.Time) error {
+	return db.WithContext(ctx).Model(&models.SeckillVoucher{}).
+		Where("voucher_id = ?", voucherID).
+		Updates(map[string]interface{}{"begin_time": beginTime, "end_time": endTime}).Error
+}
+
+// AdjustSeckillVoucherStock 调整秒杀券库存，delta 为负数时减少库存，可传入事务
+// 调整后库存小于0时返回 gorm.ErrRecordNotFound
+func AdjustSeckillVoucherStock(ctx context.Context, db *gorm.DB, voucherID uint, delta int) error {
+	result := db.WithContext(ctx).Model(&models.SeckillVoucher{}).
+		Where("voucher_id = ? AND stock + ? >= 0", voucherID, delta).
+		Update("stock", gorm.Expr("stock + ?", delta))
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// UpdateSeckillVoucherStock 更新秒杀券库存（原子操作），可传入事务
+func UpdateSeckillVoucherStock(ctx context.Context, db *gorm.DB, voucherID uint, stock int) error {
+	result := db.WithContext(ctx).Model(&models.SeckillVoucher{}).
 		Where("voucher_id = ? AND stock >= ?", voucherID, stock).
 		Update("stock", gorm.Expr("stock - ?", stock))
 
@@ -54,6 +78,27 @@ func UpdateSeckillVoucherStock(voucherID uint, stock int) error {
 	return nil
 }
 
+// IncrSeckillVoucherStock 回补秒杀券库存，可传入事务
+func IncrSeckillVoucherStock(ctx context.Context, db *gorm.DB, voucherID uint, stock int) error {
+	return db.WithContext(ctx).Model(&models.SeckillVoucher{}).
+		Where("voucher_id = ?", voucherID).
+		Update("stock", gorm.Expr("stock + ?", stock)).Error
+}
+
+// GetActiveSeckillVouchers 获取尚未结束的秒杀券
+func GetActiveSeckillVouchers(ctx context.Context, db *gorm.DB, now time.Time) ([]models.SeckillVoucher, error) {
+	var vouchers []models.SeckillVoucher
+	err := db.WithContext(ctx).Where("end_time > ?", now).Find(&vouchers).Error
+	return vouchers, err
+}
+
+// GetAllSeckillVouchers 获取所有秒杀券
+func GetAllSeckillVouchers(ctx context.Context, db *gorm.DB) ([]models.SeckillVoucher, error) {
+	var vouchers []models.SeckillVoucher
+	err := db.WithContext(ctx).Find(&vouchers).Error
+	return vouchers, err
+}
+
 // CheckSeckillVoucherExists 检查秒杀券是否存在
 func CheckSeckillVoucherExists(voucherID uint) (bool, error) {
 	var count int64
@@ -66,14 +111,136 @@ func CheckSeckillVoucherExists(voucherID uint) (bool, error) {
 
 // ============== 秒杀券相关缓存设计 =================
 const (
-	SeckillVoucherCache = "cache:seckill_voucher:stock:"
+	SeckillVoucherCache         = "cache:seckill_voucher:stock:"
+	SeckillVoucherPurchaseCache = "cache:seckill_voucher:purchase:" // 用户已购数量（hash: userId -> 数量）
+	SeckillVoucherMetaCache     = "cache:seckill_voucher:meta:"     // 秒杀券元信息（开始/结束时间、每人限购数量、是否排队、上下架状态）
 )
 
+// SetSeckillVoucherMetaCache 设置秒杀券元信息缓存，时间以毫秒时间戳存储供秒杀脚本比较
+func SetSeckillVoucherMetaCache(ctx context.Context, rds *redis.Client, voucher *models.SeckillVoucher) error {
+	key := SeckillVoucherMetaCache + strconv.Itoa(int(voucher.VoucherID))
+	limit := voucher.LimitPerUser
+	if limit <= 0 {
+		limit = 1
+	}
+	queued := 0
+	if voucher.Queued {
+		queued = 1
+	}
+	return rds.HSet(ctx, key,
+		"begin", voucher.BeginTime.UnixMilli(),
+		"end", voucher.EndTime.UnixMilli(),
+		"limit", limit,
+		"queued", queued,
+	).Err()
+}
+
+// GetSeckillVoucherMetaCache 获取秒杀券元信息缓存，缓存不存在时返回空map
+func GetSeckillVoucherMetaCache(ctx context.Context, rds *redis.Client, voucherID uint) (map[string]string, error) {
+	return rds.HGetAll(ctx, SeckillVoucherMetaCache+strconv.Itoa(int(voucherID))).Result()
+}
+
+// SetSeckillVoucherStatusCache 设置秒杀券上下架状态缓存，秒杀脚本拒绝已下架的秒杀券
+func SetSeckillVoucherStatusCache(ctx context.Context, rds *redis.Client, voucherID uint, status int) error {
+	return rds.HSet(ctx, SeckillVoucherMetaCache+strconv.Itoa(int(voucherID)), "status", status).Err()
+}
+
+// DelSeckillVoucherCache 删除秒杀券的库存、元信息和用户已购数量缓存
+func DelSeckillVoucherCache(ctx context.Context, rds *redis.Client, voucherID uint) error {
+	id := strconv.Itoa(int(voucherID))
+	return rds.Del(ctx, SeckillVoucherCache+id, SeckillVoucherMetaCache+id, SeckillVoucherPurchaseCache+id).Err()
+}
+
+// SetSeckillVoucherStockCache 设置秒杀券库存缓存
+// 库存缓存不设置过期时间，过期后秒杀脚本将无法判断库存
 func SetSeckillVoucherStockCache(ctx context.Context, rds *redis.Client, voucherID uint, stock int) error {
 	key := SeckillVoucherCache + strconv.Itoa(int(voucherID))
 	data, err := json.Marshal(stock)
 	if err != nil {
 		return err
 	}
-	return rds.Set(ctx, key, data, time.Hour).Err()
+	return rds.Set(ctx, key, data, 0).Err()
+}
+
+// InitSeckillVoucherStockCache 库存缓存不存在时写入库存，返回是否写入
+// 已存在的缓存可能包含尚未落库的预扣减，不能被数据库中的值覆盖
+func InitSeckillVoucherStockCache(ctx context.Context, rds *redis.Client, voucherID uint, stock int) (bool, error) {
+	key := SeckillVoucherCache + strconv.Itoa(int(voucherID))
+	data, err := json.Marshal(stock)
+	if err != nil {
+		return false, err
+	}
+	return rds.SetNX(ctx, key, data, 0).Result()
+}
+
+// GetSeckillVoucherStockCache 获取秒杀券库存缓存，缓存不存在时返回 nil, nil
+func GetSeckillVoucherStockCache(ctx context.Context, rds *redis.Client, voucherID uint) (*int, error) {
+	key := SeckillVoucherCache + strconv.Itoa(int(voucherID))
+	stock, err := rds.Get(ctx, key).Int()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &stock, nil
+}
+
+// SumSeckillVoucherPurchaseCache 统计缓存中所有用户的已购数量之和
+func SumSeckillVoucherPurchaseCache(ctx context.Context, rds *redis.Client, voucherID uint) (int64, error) {
+	counts, err := rds.HVals(ctx, SeckillVoucherPurchaseCache+strconv.Itoa(int(voucherID))).Result()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, c := range counts {
+		n, err := strconv.ParseInt(c, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// InitSeckillVoucherPurchaseCache 已购数量缓存不存在时使用给定的用户已购数量初始化
+func InitSeckillVoucherPurchaseCache(ctx context.Context, rds *redis.Client, voucherID uint, counts map[uint]int64) error {
+	key := SeckillVoucherPurchaseCache + strconv.Itoa(int(voucherID))
+	exists, err := rds.Exists(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if exists > 0 || len(counts) == 0 {
+		return nil
+	}
+	return rds.HSet(ctx, key, purchaseCountValues(counts)...).Err()
+}
+
+// ResetSeckillVoucherPurchaseCache 使用给定的用户已购数量重建缓存
+func ResetSeckillVoucherPurchaseCache(ctx context.Context, rds *redis.Client, voucherID uint, counts map[uint]int64) error {
+	key := SeckillVoucherPurchaseCache + strconv.Itoa(int(voucherID))
+	pipe := rds.TxPipeline()
+	pipe.Del(ctx, key)
+	if len(counts) > 0 {
+		pipe.HSet(ctx, key, purchaseCountValues(counts)...)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// purchaseCountValues 将用户已购数量展开为 HSET 参数
+func purchaseCountValues(counts map[uint]int64) []interface{} {
+	values := make([]interface{}, 0, len(counts)*2)
+	for userID, count := range counts {
+		values = append(values, userID, count)
+	}
+	return values
+}
+
+// SeckillStockReplenishedChannel 秒杀券库存回补通知频道，消息内容为秒杀券ID
+const SeckillStockReplenishedChannel = "seckill:stock:replenished"
+
+// PublishSeckillStockReplenished 通知所有实例秒杀券库存已回补
+func PublishSeckillStockReplenished(ctx context.Context, rds *redis.Client, voucherID uint) error {
+	return rds.Publish(ctx, SeckillStockReplenishedChannel, voucherID).Err()
 }
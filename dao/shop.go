@@ -2,12 +2,9 @@ package dao
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"hm-dianping-go/models"
 	"strconv"
-	"time"
 
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
@@ -34,75 +31,52 @@ func GetAllShopIDs(ctx context.Context, db *gorm.DB) ([]uint, error) {
 	return ids, nil
 }
 
-func UpdateShop(ctx context.Context, db *gorm.DB, shop *models.Shop) error {
-	err := db.Model(&models.Shop{}).Where("id = ?", shop.ID).Updates(shop).Error
-	if err != nil {
-		return err
-	}
-	return nil
+// CreateShop 创建商铺
+func CreateShop(ctx context.Context, db *gorm.DB, shop *models.Shop) error {
+	return db.WithContext(ctx).Create(shop).Error
 }
 
-/* ================缓存相关================ */
-
-const (
-	ShopCache         = "cache:shop:description:"
-	ShopLocationCache = "cache:shop:location:"
-)
-
-func GetShopCacheById(ctx context.Context, rds *redis.Client, shopId uint) (*models.Shop, error) {
-	key := ShopCache + strconv.Itoa(int(shopId))
-	result := rds.Get(ctx, key)
-
-	// 1. 先判断 Redis 是否返回错误
-	if result.Err() != nil {
-		// 区分"缓存未命中"和"其他错误"
-		if errors.Is(result.Err(), redis.Nil) {
-			return nil, nil // 缓存未命中：返回 nil, nil（或自定义一个"未命中"错误）
-		}
-		// 其他错误（如连接失败）：返回 nil + 具体错误
-		return nil, fmt.Errorf("redis query failed: %w", result.Err())
+// GetShopsByIDs 根据ID批量查询商铺，结果按传入ID的顺序排列，不存在的ID会被忽略
+func GetShopsByIDs(ctx context.Context, db *gorm.DB, ids []uint) ([]models.Shop, error) {
+	if len(ids) == 0 {
+		return []models.Shop{}, nil
 	}
-
-	// 2. Redis 键存在，获取JSON字符串
-	jsonStr, err := result.Result()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get cache result: %w", err)
+	var shops []models.Shop
+	if err := db.WithContext(ctx).Where("id IN ?", ids).Find(&shops).Error; err != nil {
+		return nil, err
 	}
 
-	// 3. JSON反序列化
-	shop := &models.Shop{}
-	if err := json.Unmarshal([]byte(jsonStr), shop); err != nil {
-		// 缓存数据损坏：返回 nil + 反序列化错误
-		return nil, fmt.Errorf("cache data unmarshal failed: %w", err)
+	shopMap := make(map[uint]models.Shop, len(shops))
+	for _, shop := range shops {
+		shopMap[shop.ID] = shop
 	}
-
-	// 4. 反序列化成功：返回有效 shop 对象
-	return shop, nil
-}
-
-func SetShopCacheById(ctx context.Context, rds *redis.Client, shopId uint, shop *models.Shop) error {
-	// JSON序列化
-	jsonData, err := json.Marshal(shop)
-	if err != nil {
-		return fmt.Errorf("failed to marshal shop to json: %w", err)
+	ordered := make([]models.Shop, 0, len(shops))
+	for _, id := range ids {
+		if shop, ok := shopMap[id]; ok {
+			ordered = append(ordered, shop)
+		}
 	}
+	return ordered, nil
+}
 
-	// 存储到Redis
-	err = rds.Set(ctx, ShopCache+strconv.Itoa(int(shopId)), jsonData, time.Hour).Err()
-	if err != nil {
-		return fmt.Errorf("failed to set cache: %w", err)
-	}
-	return nil
+// UpdateShopFields 更新商铺的指定字段，可传入事务
+func UpdateShopFields(ctx context.Context, db *gorm.DB, shopId uint, updates map[string]interface{}) error {
+	return db.WithContext(ctx).Model(&models.Shop{}).Where("id = ?", shopId).Updates(updates).Error
 }
 
-func DelShopCacheById(ctx context.Context, rds *redis.Client, shopId uint) error {
-	err := rds.Del(ctx, ShopCache+strconv.Itoa(int(shopId))).Err()
-	if err != nil {
-		return err
-	}
-	return nil
+// DeleteShop 删除商铺（软删除）
+func DeleteShop(ctx context.Context, db *gorm.DB, shopId uint) error {
+	return db.WithContext(ctx).Delete(&models.Shop{}, shopId).Error
 }
 
+/* ================缓存相关================ */
+
+const (
+	ShopCache         = "cache:shop:description:"
+	HotShopCache      = "cache:shop:hot:" // 热点商铺逻辑过期缓存
+	ShopLocationCache = "cache:shop:location:"
+)
+
 // LoadShopData 加载店铺地理位置数据到缓存，按照类型进行存到不同key当中
 func LoadShopData(ctx context.Context, db *gorm.DB, rds *redis.Client) error {
 	// 1. 查询所有的店铺
@@ -129,6 +103,33 @@ func LoadShopData(ctx context.Context, db *gorm.DB, rds *redis.Client) error {
 	return nil
 }
 
+// AddShopLocation 将店铺位置加入所属类型的地理位置缓存
+func AddShopLocation(ctx context.Context, rds *redis.Client, shop *models.Shop) error {
+	return rds.GeoAdd(ctx, ShopLocationCache+strconv.Itoa(int(shop.TypeID)), &redis.GeoLocation{
+		Name:      strconv.Itoa(int(shop.ID)),
+		Latitude:  shop.Y,
+		Longitude: shop.X,
+	}).Err()
+}
+
+// MoveShopLocation 店铺类型或坐标变更后，在同一个事务中移除旧类型下的位置并写入新位置
+func MoveShopLocation(ctx context.Context, rds *redis.Client, oldShop, newShop *models.Shop) error {
+	pipe := rds.TxPipeline()
+	pipe.ZRem(ctx, ShopLocationCache+strconv.Itoa(int(oldShop.TypeID)), strconv.Itoa(int(oldShop.ID)))
+	pipe.GeoAdd(ctx, ShopLocationCache+strconv.Itoa(int(newShop.TypeID)), &redis.GeoLocation{
+		Name:      strconv.Itoa(int(newShop.ID)),
+		Latitude:  newShop.Y,
+		Longitude: newShop.X,
+	})
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RemoveShopLocation 从地理位置缓存中移除店铺
+func RemoveShopLocation(ctx context.Context, rds *redis.Client, shop *models.Shop) error {
+	return rds.ZRem(ctx, ShopLocationCache+strconv.Itoa(int(shop.TypeID)), strconv.Itoa(int(shop.ID))).Err()
+}
+
 // GetNearbyShops 获取某个店铺的附近某个距离的所有点
 func GetNearbyShops(ctx context.Context, rds *redis.Client, shop *models.Shop, radius float64, unit string, count int) ([]uint, error) {
 	key := ShopLocationCache + strconv.Itoa(int(shop.TypeID))
@@ -150,3 +151,23 @@ func GetNearbyShops(ctx context.Context, rds *redis.Client, shop *models.Shop, r
 	}
 	return shopIds, nil
 }
+
+// SearchShopsByLocation 按距离由近到远查询指定位置附近某个类型的店铺，返回店铺ID和距离（米）
+func SearchShopsByLocation(ctx context.Context, rds *redis.Client, typeID uint, x, y, radius float64, count int) ([]redis.GeoLocation, error) {
+	key := ShopLocationCache + strconv.Itoa(int(typeID))
+	locations, err := rds.GeoSearchLocation(ctx, key, &redis.GeoSearchLocationQuery{
+		GeoSearchQuery: redis.GeoSearchQuery{
+			Longitude:  x,
+			Latitude:   y,
+			Radius:     radius,
+			RadiusUnit: "m",
+			Sort:       "ASC",
+			Count:      count,
+		},
+		WithDist: true,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to search geo cache: %w", err)
+	}
+	return locations, nil
+}
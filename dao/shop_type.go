@@ -2,9 +2,7 @@ package dao
 
 import (
 	"context"
-	"time"
 
-	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 
 	"hm-dianping-go/models"
@@ -19,31 +17,18 @@ func GetShopTypeList(ctx context.Context, db *gorm.DB) ([]*models.ShopType, erro
 	return shopTypes, nil
 }
 
+// ExistsShopType 判断商铺类型是否存在
+func ExistsShopType(ctx context.Context, db *gorm.DB, typeID uint) (bool, error) {
+	var count int64
+	err := db.WithContext(ctx).Model(&models.ShopType{}).Where("id = ?", typeID).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
 // ===========缓存相关=============
 
 const (
-	ShopTypeCache = "cache:shop_type"
+	ShopTypeCache = "cache:shop_type:"
 )
-
-func GetShopTypeListCache(ctx context.Context, rds *redis.Client) ([]*models.ShopType, error) {
-	key := ShopTypeCache
-	result := rds.Get(ctx, key)
-	if result.Err() != nil {
-		return nil, result.Err()
-	}
-
-	var shopTypes []*models.ShopType
-	if err := result.Scan(&shopTypes); err != nil {
-		return nil, err
-	}
-	return shopTypes, nil
-}
-
-func SetShopTypeListCache(ctx context.Context, rds *redis.Client, shopTypes []*models.ShopType) error {
-	// 设置一小时的过期时间
-	err := rds.Set(ctx, ShopTypeCache, shopTypes, time.Hour).Err()
-	if err != nil {
-		return err
-	}
-	return nil
-}
@@ -77,6 +77,7 @@ func GetUserByIDs(ids []uint) ([]models.User, error) {
 // ===== redis 相关
 const (
 	SignUserKey = "user:sign:%d:%s" // sign:userID:month
+	UserCache   = "cache:user:"     // 用户信息缓存
 )
 
 // SignUser 签到
@@ -1,7 +1,10 @@
 package dao
 
 import (
+	"context"
 	"hm-dianping-go/models"
+
+	"gorm.io/gorm"
 )
 
 // GetAllVoucherIDs 获取所有优惠券ID
@@ -12,4 +15,66 @@ func GetAllVoucherIDs() ([]uint, error) {
 		return nil, err
 	}
 	return ids, nil
-}
\ No newline at end of file
+}
+
+// GetVoucherByID 根据ID获取优惠券
+func GetVoucherByID(ctx context.Context, db *gorm.DB, voucherID uint) (*models.Voucher, error) {
+	var voucher models.Voucher
+	err := db.WithContext(ctx).First(&voucher, voucherID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &voucher, nil
+}
+
+// DecrVoucherStock 扣减上架中优惠券的库存（乐观锁），可传入事务
+// 库存不足或优惠券已下架时返回 gorm.ErrRecordNotFound
+func DecrVoucherStock(ctx context.Context, db *gorm.DB, voucherID uint, count int) error {
+	result := db.WithContext(ctx).Model(&models.Voucher{}).
+		Where("id = ? AND status = ? AND stock >= ?", voucherID, 1, count).
+		Update("stock", gorm.Expr("stock - ?", count))
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	// 检查是否有行被更新，如果没有说明库存不足
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// IncrVoucherStock 回补优惠券库存，可传入事务
+func IncrVoucherStock(ctx context.Context, db *gorm.DB, voucherID uint, count int) error {
+	return db.WithContext(ctx).Model(&models.Voucher{}).
+		Where("id = ?", voucherID).
+		Update("stock", gorm.Expr("stock + ?", count)).Error
+}
+
+// UpdateVoucherFields 更新优惠券的指定字段，可传入事务
+func UpdateVoucherFields(ctx context.Context, db *gorm.DB, voucherID uint, updates map[string]interface{}) error {
+	return db.WithContext(ctx).Model(&models.Voucher{}).Where("id = ?", voucherID).Updates(updates).Error
+}
+
+// AdjustVoucherStock 调整优惠券库存，delta 为负数时减少库存，可传入事务
+// 调整后库存小于0时返回 gorm.ErrRecordNotFound
+func AdjustVoucherStock(ctx context.Context, db *gorm.DB, voucherID uint, delta int) error {
+	result := db.WithContext(ctx).Model(&models.Voucher{}).
+		Where("id = ? AND stock + ? >= 0", voucherID, delta).
+		Update("stock", gorm.Expr("stock + ?", delta))
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteVoucher 删除优惠券（软删除），可传入事务
+func DeleteVoucher(ctx context.Context, db *gorm.DB, voucherID uint) error {
+	return db.WithContext(ctx).Delete(&models.Voucher{}, voucherID).Error
+}
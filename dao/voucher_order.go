@@ -2,9 +2,12 @@ package dao
 
 import (
 	"context"
+	"errors"
 	"hm-dianping-go/models"
 	"strconv"
+	"time"
 
+	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 )
 
@@ -13,6 +16,22 @@ func CreateVoucherOrder(ctx context.Context, db *gorm.DB, order *models.VoucherO
 	return db.WithContext(ctx).Create(order).Error
 }
 
+// SeckillOrderKey 生成秒杀订单唯一键 "userId:voucherId:n"，n 为用户在该秒杀券下的购买序号（1 ~ 每人限购数量）
+// 序号占满后无法再生成新的唯一键，以此在数据库层面保证每人限购
+func SeckillOrderKey(userID, voucherID uint, seq int) *string {
+	key := strconv.FormatUint(uint64(userID), 10) + ":" + strconv.FormatUint(uint64(voucherID), 10) + ":" + strconv.Itoa(seq)
+	return &key
+}
+
+// GetUserSeckillOrderKeys 获取用户在某秒杀券下已占用的订单唯一键
+func GetUserSeckillOrderKeys(ctx context.Context, db *gorm.DB, userID, voucherID uint) ([]string, error) {
+	var keys []string
+	err := db.WithContext(ctx).Model(&models.VoucherOrder{}).
+		Where("user_id = ? AND voucher_id = ? AND seckill_key IS NOT NULL", userID, voucherID).
+		Pluck("seckill_key", &keys).Error
+	return keys, err
+}
+
 // GetVoucherOrderByID 根据订单ID获取订单信息
 func GetVoucherOrderByID(ctx context.Context, db *gorm.DB, orderID uint) (*models.VoucherOrder, error) {
 	var order models.VoucherOrder
@@ -23,6 +42,26 @@ func GetVoucherOrderByID(ctx context.Context, db *gorm.DB, orderID uint) (*model
 	return &order, nil
 }
 
+// GetVoucherOrderByRedeemCode 根据核销短码获取订单
+func GetVoucherOrderByRedeemCode(ctx context.Context, db *gorm.DB, code string) (*models.VoucherOrder, error) {
+	var order models.VoucherOrder
+	err := db.WithContext(ctx).Where("redeem_code = ?", code).First(&order).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// GetVoucherOrderByRedeemToken 根据核销令牌获取订单
+func GetVoucherOrderByRedeemToken(ctx context.Context, db *gorm.DB, token string) (*models.VoucherOrder, error) {
+	var order models.VoucherOrder
+	err := db.WithContext(ctx).Where("redeem_token = ?", token).First(&order).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
 // GetVoucherOrderByUserAndVoucher 根据用户ID和优惠券ID获取订单
 func GetVoucherOrderByUserAndVoucher(ctx context.Context, db *gorm.DB, userID, voucherID uint) (*models.VoucherOrder, error) {
 	var order models.VoucherOrder
@@ -53,6 +92,40 @@ func CheckSeckillVoucherOrderExists(ctx context.Context, db *gorm.DB, userID, vo
 	return count > 0, nil
 }
 
+// releasedOrderStatus 已取消、已退款的订单不再占用库存和购买资格
+var releasedOrderStatus = []int{models.OrderStatusCancelled, models.OrderStatusRefunded}
+
+// CountSeckillOrdersByVoucher 统计某秒杀券占用库存的订单数量
+func CountSeckillOrdersByVoucher(ctx context.Context, db *gorm.DB, voucherID uint) (int64, error) {
+	var count int64
+	err := db.WithContext(ctx).Model(&models.VoucherOrder{}).
+		Where("voucher_id = ? AND voucher_type = ? AND status NOT IN ?", voucherID, 2, releasedOrderStatus).
+		Count(&count).Error
+	return count, err
+}
+
+// GetSeckillOrderCountsByUser 按用户统计某秒杀券占用购买资格的订单数量
+func GetSeckillOrderCountsByUser(ctx context.Context, db *gorm.DB, voucherID uint) (map[uint]int64, error) {
+	var rows []struct {
+		UserID uint
+		Count  int64
+	}
+	err := db.WithContext(ctx).Model(&models.VoucherOrder{}).
+		Select("user_id, COUNT(*) AS count").
+		Where("voucher_id = ? AND voucher_type = ? AND status NOT IN ?", voucherID, 2, releasedOrderStatus).
+		Group("user_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.UserID] = row.Count
+	}
+	return counts, nil
+}
+
 // UpdateVoucherOrder 更新订单信息
 func UpdateVoucherOrder(ctx context.Context, db *gorm.DB, order *models.VoucherOrder) error {
 	return db.WithContext(ctx).Save(order).Error
@@ -63,6 +136,26 @@ func UpdateVoucherOrderStatus(ctx context.Context, db *gorm.DB, orderID uint, st
 	return db.WithContext(ctx).Model(&models.VoucherOrder{}).Where("id = ?", orderID).Update("status", status).Error
 }
 
+// TransitVoucherOrderStatus 订单状态流转（CAS），只有当前状态为 from 时才会更新为 to，可传入事务
+// updates 为随状态一起更新的其他字段；订单状态已被并发修改时返回 gorm.ErrRecordNotFound
+func TransitVoucherOrderStatus(ctx context.Context, db *gorm.DB, orderID uint, from, to int, updates map[string]interface{}) error {
+	values := map[string]interface{}{"status": to}
+	for k, v := range updates {
+		values[k] = v
+	}
+
+	result := db.WithContext(ctx).Model(&models.VoucherOrder{}).
+		Where("id = ? AND status = ?", orderID, from).
+		Updates(values)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
 // DeleteVoucherOrder 删除订单（软删除）
 func DeleteVoucherOrder(ctx context.Context, db *gorm.DB, orderID uint) error {
 	return db.WithContext(ctx).Delete(&models.VoucherOrder{}, orderID).Error
@@ -72,7 +165,7 @@ func DeleteVoucherOrder(ctx context.Context, db *gorm.DB, orderID uint) error {
 func GetVoucherOrdersByUser(ctx context.Context, db *gorm.DB, userID uint, page, size int) ([]models.VoucherOrder, error) {
 	var orders []models.VoucherOrder
 	offset := (page - 1) * size
-	err := db.WithContext(ctx).Where("user_id = ?", userID).Offset(offset).Limit(size).Find(&orders).Error
+	err := db.WithContext(ctx).Where("user_id = ?", userID).Order("id desc").Offset(offset).Limit(size).Find(&orders).Error
 	return orders, err
 }
 
@@ -98,6 +191,54 @@ func CountVoucherOrdersByVoucher(ctx context.Context, db *gorm.DB, voucherID uin
 	return count, err
 }
 
+// GetUnpaidSeckillOrders 获取未支付的秒杀订单，按订单ID分页（afterID 为上一页最后一个订单ID）
+func GetUnpaidSeckillOrders(ctx context.Context, db *gorm.DB, afterID uint, limit int) ([]models.VoucherOrder, error) {
+	var orders []models.VoucherOrder
+	err := db.WithContext(ctx).
+		Where("id > ? AND voucher_type = ? AND status = ?", afterID, 2, models.OrderStatusUnpaid).
+		Order("id").Limit(limit).Find(&orders).Error
+	return orders, err
+}
+
+// RecordCancelledOrderPayment 已取消的订单收到支付成功通知时记录支付信息，并标记为待退款
+// 订单不是已取消状态或已记录过支付信息时返回 gorm.ErrRecordNotFound
+func RecordCancelledOrderPayment(ctx context.Context, db *gorm.DB, orderID uint, paymentNo, provider string, amount int64) error {
+	result := db.WithContext(ctx).Model(&models.VoucherOrder{}).
+		Where("id = ? AND status = ? AND payment_no IS NULL", orderID, models.OrderStatusCancelled).
+		Updates(map[string]interface{}{
+			"payment_no":    paymentNo,
+			"pay_provider":  provider,
+			"pay_amount":    amount,
+			"refund_status": models.RefundStatusPending,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// MarkCancelledOrderRefunded 将待退款的已取消订单标记为已退款，重复标记不会报错
+func MarkCancelledOrderRefunded(ctx context.Context, db *gorm.DB, orderID uint, refundTime time.Time) error {
+	return db.WithContext(ctx).Model(&models.VoucherOrder{}).
+		Where("id = ? AND refund_status = ?", orderID, models.RefundStatusPending).
+		Updates(map[string]interface{}{
+			"refund_status": models.RefundStatusDone,
+			"refund_time":   refundTime,
+		}).Error
+}
+
+// GetPendingRefundOrders 获取待退款的已取消订单，按订单ID分页（afterID 为上一页最后一个订单ID）
+func GetPendingRefundOrders(ctx context.Context, db *gorm.DB, afterID uint, limit int) ([]models.VoucherOrder, error) {
+	var orders []models.VoucherOrder
+	err := db.WithContext(ctx).
+		Where("id > ? AND refund_status = ?", afterID, models.RefundStatusPending).
+		Order("id").Limit(limit).Find(&orders).Error
+	return orders, err
+}
+
 // ======== 用户订单缓存 =========
 const (
 	userOrderSetCache = "cache:seckill_voucher:order:"
@@ -107,3 +248,76 @@ const (
 func AddUserOrderToCache(ctx context.Context, userID, orderID uint) error {
 	return Redis.SAdd(ctx, userOrderSetCache+strconv.Itoa(int(userID)), orderID).Err()
 }
+
+// ======== 秒杀订单处理状态 =========
+const (
+	SeckillOrderStatusKey = "seckill:order:status:"
+	SeckillOrderStatusTTL = 24 * time.Hour
+
+	SeckillOrderPending = "pending" // 已获得购买资格，等待消费者创建订单
+	SeckillOrderCreated = "created" // 订单已落库
+	SeckillOrderFailed  = "failed"  // 订单创建失败
+)
+
+// SeckillOrderStatus 秒杀订单在Redis中的处理状态，由Lua脚本写入、Stream消费者更新
+type SeckillOrderStatus struct {
+	Status    string
+	UserID    uint
+	VoucherID uint
+	Reason    string
+}
+
+// GetSeckillOrderStatus 获取秒杀订单处理状态，记录不存在时返回 nil, nil
+func GetSeckillOrderStatus(ctx context.Context, rds *redis.Client, orderID uint) (*SeckillOrderStatus, error) {
+	values, err := rds.HGetAll(ctx, SeckillOrderStatusKey+strconv.FormatUint(uint64(orderID), 10)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	userID, err := strconv.ParseUint(values["userId"], 10, 32)
+	if err != nil {
+		return nil, errors.New("订单状态记录中的userId无效")
+	}
+	voucherID, err := strconv.ParseUint(values["voucherId"], 10, 32)
+	if err != nil {
+		return nil, errors.New("订单状态记录中的voucherId无效")
+	}
+
+	return &SeckillOrderStatus{
+		Status:    values["status"],
+		UserID:    uint(userID),
+		VoucherID: uint(voucherID),
+		Reason:    values["reason"],
+	}, nil
+}
+
+// SetSeckillOrderStatus 更新秒杀订单处理状态
+func SetSeckillOrderStatus(ctx context.Context, rds *redis.Client, orderID uint, status, reason string) error {
+	key := SeckillOrderStatusKey + strconv.FormatUint(uint64(orderID), 10)
+	pipe := rds.TxPipeline()
+	pipe.HSet(ctx, key, "status", status, "reason", reason)
+	pipe.Expire(ctx, key, SeckillOrderStatusTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ======== 订单支付超时延迟队列 =========
+const (
+	OrderPayTimeoutQueue = "seckill:order:delay" // 待支付订单延迟队列（zset: orderId -> 支付截止时间毫秒时间戳）
+)
+
+// AddOrderPayTimeout 将订单加入支付超时延迟队列，订单已在队列中时保留原截止时间
+func AddOrderPayTimeout(ctx context.Context, rds *redis.Client, orderID uint, deadline time.Time) error {
+	return rds.ZAddNX(ctx, OrderPayTimeoutQueue, &redis.Z{
+		Score:  float64(deadline.UnixMilli()),
+		Member: strconv.FormatUint(uint64(orderID), 10),
+	}).Err()
+}
+
+// RemoveOrderPayTimeout 将订单移出支付超时延迟队列
+func RemoveOrderPayTimeout(ctx context.Context, rds *redis.Client, orderID uint) error {
+	return rds.ZRem(ctx, OrderPayTimeoutQueue, strconv.FormatUint(uint64(orderID), 10)).Err()
+}
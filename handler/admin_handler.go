@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"hm-dianping-go/service"
+	"hm-dianping-go/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListSeckillDeadLetters 查看秒杀订单死信队列
+func ListSeckillDeadLetters(c *gin.Context) {
+	count, err := strconv.ParseInt(c.DefaultQuery("count", "20"), 10, 64)
+	if err != nil || count <= 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的数量")
+		return
+	}
+
+	result := service.ListDeadLetters(c.Request.Context(), count)
+	utils.Response(c, result)
+}
+
+// ReplaySeckillDeadLetter 重新投递秒杀订单死信消息
+func ReplaySeckillDeadLetter(c *gin.Context) {
+	result := service.ReplayDeadLetter(c.Request.Context(), c.Param("id"))
+	utils.Response(c, result)
+}
+
+// DiscardSeckillDeadLetter 丢弃秒杀订单死信消息
+func DiscardSeckillDeadLetter(c *gin.Context) {
+	result := service.DiscardDeadLetter(c.Request.Context(), c.Param("id"))
+	utils.Response(c, result)
+}
+
+// GetSeckillReconcileReport 获取最近一次秒杀对账结果
+func GetSeckillReconcileReport(c *gin.Context) {
+	result := service.GetLastSeckillReconcileReport()
+	utils.Response(c, result)
+}
+
+// RunSeckillReconcile 立即执行秒杀对账，repair=true 时使用MySQL数据修复Redis
+func RunSeckillReconcile(c *gin.Context) {
+	repair, err := strconv.ParseBool(c.DefaultQuery("repair", "false"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的repair参数")
+		return
+	}
+
+	result := service.RunSeckillReconcile(c.Request.Context(), repair)
+	utils.Response(c, result)
+}
@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"hm-dianping-go/service"
+	"hm-dianping-go/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PaymentCallback 支付结果回调，签名校验在对应支付渠道中完成，因此需要读取原始请求体
+func PaymentCallback(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "读取请求体失败")
+		return
+	}
+
+	result := service.HandlePaymentCallback(c.Request.Context(), c.Param("provider"), c.Request.Header, body)
+	utils.Response(c, result)
+}
@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"hm-dianping-go/models"
 	"hm-dianping-go/service"
 	"hm-dianping-go/utils"
 	"net/http"
@@ -32,7 +31,7 @@ func GetShopList(c *gin.Context) {
 	utils.Response(c, result)
 }
 
-// GetShopByType 根据类型获取商铺
+// GetShopByType 根据类型获取商铺，传入用户坐标 x、y 时按距离由近到远返回附近的商铺
 func GetShopByType(c *gin.Context) {
 	typeIdStr := c.Query("typeId")
 	if typeIdStr == "" {
@@ -49,7 +48,27 @@ func GetShopByType(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("current", "1"))
 	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
 
-	result := service.GetShopByType(uint(typeId), page, size)
+	// 未传坐标时按数据库分页查询
+	xStr, yStr := c.Query("x"), c.Query("y")
+	if xStr == "" || yStr == "" {
+		result := service.GetShopByType(uint(typeId), page, size)
+		utils.Response(c, result)
+		return
+	}
+
+	x, errX := strconv.ParseFloat(xStr, 64)
+	y, errY := strconv.ParseFloat(yStr, 64)
+	if errX != nil || errY != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的坐标")
+		return
+	}
+	radius, err := strconv.ParseFloat(c.DefaultQuery("radius", "0"), 64)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的半径")
+		return
+	}
+
+	result := service.GetShopByTypeNearby(c.Request.Context(), uint(typeId), x, y, radius, page, size)
 	utils.Response(c, result)
 }
 
@@ -65,21 +84,57 @@ func GetShopByName(c *gin.Context) {
 
 // SaveShop 新增商铺
 func SaveShop(c *gin.Context) {
-	// TODO: 实现新增商铺功能
-	utils.ErrorResponse(c, http.StatusNotImplemented, "功能未完成")
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+
+	var req service.CreateShopRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	result := service.CreateShop(c.Request.Context(), userID.(uint), &req)
+	utils.Response(c, result)
 }
 
 // UpdateShop 更新商铺信息
 func UpdateShop(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+
 	// 1. 参数校验
-	var shop models.Shop
-	if err := c.ShouldBindJSON(&shop); err != nil {
+	var req service.UpdateShopRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		utils.ErrorResponse(c, http.StatusBadRequest, "参数校验失败")
 		return
 	}
 
 	// 2. 更新商铺
-	result := service.UpdateShopById(c.Request.Context(), &shop)
+	result := service.UpdateShopById(c.Request.Context(), userID.(uint), &req)
+	utils.Response(c, result)
+}
+
+// DeleteShop 删除商铺
+func DeleteShop(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的商铺ID")
+		return
+	}
+
+	result := service.DeleteShop(c.Request.Context(), userID.(uint), uint(id))
 	utils.Response(c, result)
 }
 
@@ -29,12 +29,30 @@ func GetVoucherList(c *gin.Context) {
 
 // AddVoucher 新增普通券
 func AddVoucher(c *gin.Context) {
-	// TODO: 实现新增普通券功能
-	utils.ErrorResponse(c, http.StatusNotImplemented, "功能未完成")
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+
+	var req service.AddVoucherRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result := service.AddVoucher(c.Request.Context(), userID.(uint), &req)
+	utils.Response(c, result)
 }
 
 // AddSeckillVoucher 新增秒杀券
 func AddSeckillVoucher(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+
 	var req service.AddSeckillVoucherRequest
 
 	// 绑定JSON数据到请求结构体
@@ -44,7 +62,7 @@ func AddSeckillVoucher(c *gin.Context) {
 	}
 
 	// 调用service层处理业务逻辑
-	result := service.AddSeckillVoucher(c.Request.Context(), &req)
+	result := service.AddSeckillVoucher(c.Request.Context(), userID.(uint), &req)
 	utils.Response(c, result)
 }
 
@@ -65,3 +83,103 @@ func GetSeckillVoucher(c *gin.Context) {
 	result := service.GetSeckillVoucher(uint(voucherId))
 	utils.Response(c, result)
 }
+
+// UpdateVoucher 修改优惠券信息
+func UpdateVoucher(c *gin.Context) {
+	userID, voucherId, ok := parseManageVoucherParams(c)
+	if !ok {
+		return
+	}
+
+	var req service.UpdateVoucherRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result := service.UpdateVoucher(c.Request.Context(), userID, voucherId, &req)
+	utils.Response(c, result)
+}
+
+// UpdateVoucherStatus 上架/下架优惠券
+func UpdateVoucherStatus(c *gin.Context) {
+	userID, voucherId, ok := parseManageVoucherParams(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Status int `json:"status" binding:"required,oneof=1 2"` // 1-上架，2-下架
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result := service.UpdateVoucherStatus(c.Request.Context(), userID, voucherId, req.Status)
+	utils.Response(c, result)
+}
+
+// UpdateVoucherTime 修改优惠券有效期（秒杀券即秒杀时间）
+func UpdateVoucherTime(c *gin.Context) {
+	userID, voucherId, ok := parseManageVoucherParams(c)
+	if !ok {
+		return
+	}
+
+	var req service.UpdateVoucherTimeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result := service.UpdateVoucherTime(c.Request.Context(), userID, voucherId, &req)
+	utils.Response(c, result)
+}
+
+// AdjustVoucherStock 调整优惠券库存
+func AdjustVoucherStock(c *gin.Context) {
+	userID, voucherId, ok := parseManageVoucherParams(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Delta int `json:"delta" binding:"required"` // 库存调整量，负数表示减少库存
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result := service.AdjustVoucherStock(c.Request.Context(), userID, voucherId, req.Delta)
+	utils.Response(c, result)
+}
+
+// DeleteVoucher 删除优惠券
+func DeleteVoucher(c *gin.Context) {
+	userID, voucherId, ok := parseManageVoucherParams(c)
+	if !ok {
+		return
+	}
+
+	result := service.DeleteVoucher(c.Request.Context(), userID, voucherId)
+	utils.Response(c, result)
+}
+
+// parseManageVoucherParams 解析当前用户和路径中的优惠券ID，解析失败时已写入响应
+func parseManageVoucherParams(c *gin.Context) (uint, uint, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return 0, 0, false
+	}
+
+	voucherId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的优惠券ID")
+		return 0, 0, false
+	}
+
+	return userID.(uint), uint(voucherId), true
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"hm-dianping-go/service"
 	"hm-dianping-go/utils"
 	"net/http"
@@ -28,3 +29,133 @@ func SeckillVoucher(c *gin.Context) {
 	result := service.SeckillVoucher(ctx, userID.(uint), uint(voucherId))
 	utils.Response(c, result)
 }
+
+// IssueSeckillTicket 领取排队秒杀券的排队号
+func IssueSeckillTicket(c *gin.Context) {
+	handleSeckillTicketAction(c, service.IssueSeckillTicket)
+}
+
+// GetSeckillTicket 查询排队状态
+func GetSeckillTicket(c *gin.Context) {
+	handleSeckillTicketAction(c, service.GetSeckillTicket)
+}
+
+// handleSeckillTicketAction 解析当前用户和秒杀券ID后执行排队操作
+func handleSeckillTicketAction(c *gin.Context, action func(ctx context.Context, userId, voucherId uint) *utils.Result) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+
+	voucherId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的优惠券ID")
+		return
+	}
+
+	result := action(c.Request.Context(), userID.(uint), uint(voucherId))
+	utils.Response(c, result)
+}
+
+// BuyNormalVoucher 购买普通优惠券
+func BuyNormalVoucher(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+
+	voucherId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的优惠券ID")
+		return
+	}
+
+	result := service.BuyNormalVoucher(c.Request.Context(), userID.(uint), uint(voucherId))
+	utils.Response(c, result)
+}
+
+// GetVoucherOrder 查询订单详情及处理状态
+func GetVoucherOrder(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+
+	orderId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的订单ID")
+		return
+	}
+
+	result := service.GetVoucherOrder(c.Request.Context(), userID.(uint), uint(orderId))
+	utils.Response(c, result)
+}
+
+// GetMyVoucherOrders 获取我的订单列表
+func GetMyVoucherOrders(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("current", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
+
+	result := service.GetMyVoucherOrders(c.Request.Context(), userID.(uint), page, size)
+	utils.Response(c, result)
+}
+
+// PayVoucherOrder 发起订单支付
+func PayVoucherOrder(c *gin.Context) {
+	handleVoucherOrderAction(c, service.PayVoucherOrder)
+}
+
+// RefundVoucherOrder 订单退款
+func RefundVoucherOrder(c *gin.Context) {
+	handleVoucherOrderAction(c, service.RefundVoucherOrder)
+}
+
+// CancelVoucherOrder 取消订单
+func CancelVoucherOrder(c *gin.Context) {
+	handleVoucherOrderAction(c, service.CancelVoucherOrder)
+}
+
+// RedeemVoucherOrder 商家到店核销订单
+func RedeemVoucherOrder(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+
+	var req service.RedeemVoucherOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result := service.RedeemVoucherOrder(c.Request.Context(), userID.(uint), &req)
+	utils.Response(c, result)
+}
+
+// handleVoucherOrderAction 解析当前用户和订单ID后执行订单操作
+func handleVoucherOrderAction(c *gin.Context, action func(ctx context.Context, userId, orderId uint) *utils.Result) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+
+	orderId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "无效的订单ID")
+		return
+	}
+
+	result := action(c.Request.Context(), userID.(uint), uint(orderId))
+	utils.Response(c, result)
+}
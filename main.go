@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"hm-dianping-go/config"
 	"hm-dianping-go/dao"
 	"hm-dianping-go/models"
 	"hm-dianping-go/router"
+	"hm-dianping-go/script"
 	"hm-dianping-go/service"
 	"hm-dianping-go/utils"
 	"log"
@@ -37,12 +40,26 @@ func main() {
 		log.Fatalf("Failed to initialize Redis: %v", err)
 	}
 
+	// 预加载Lua脚本
+	if err := script.LoadAll(context.Background(), dao.Redis); err != nil {
+		log.Fatalf("Failed to load lua scripts: %v", err)
+	}
+
+	// 执行子命令（如 reconcile），执行完成后直接退出，不启动HTTP服务
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Arg(0), flag.Args()[1:]); err != nil {
+			log.Fatalf("Failed to run command %s: %v", flag.Arg(0), err)
+		}
+		return
+	}
+
 	// 自动迁移数据库表
 	if err := dao.DB.AutoMigrate(
 		&models.User{},
 		&models.Shop{},
 		&models.ShopType{},
 		&models.Voucher{},
+		&models.SeckillVoucher{},
 		&models.VoucherOrder{},
 		&models.Blog{},
 		&models.Follow{},
@@ -57,6 +74,16 @@ func main() {
 		// 布隆过滤器初始化失败不应该阻止服务启动，只记录警告
 	}
 
+	// 预热秒杀券库存和已下单用户到Redis
+	if err := service.WarmUpSeckillVouchers(context.Background()); err != nil {
+		log.Printf("Warning: Failed to warm up seckill vouchers: %v", err)
+	}
+
+	// 预热热点商铺的逻辑过期缓存
+	if _, err := service.WarmUpHotShops(context.Background()); err != nil {
+		log.Printf("Warning: Failed to warm up hot shops: %v", err)
+	}
+
 	// 初始化订单队列和worker，如果需要让后端自行进行阻塞队列的话，可以使用，现在的优化方案是使用redis的消息队列机制来进行
 	// service.InitOrderQueue()
 
@@ -70,6 +97,24 @@ func main() {
 		log.Fatalf("Failed to load shop locations: %v", err)
 	}
 
+	// 启动后台秒杀对账任务
+	service.StartSeckillReconciler()
+
+	// 启动秒杀订单支付超时取消任务
+	service.StartOrderPayTimeoutCanceller()
+
+	// 订阅秒杀券库存回补通知，清除本地售罄标记
+	service.StartSeckillSoldOutSubscriber()
+
+	// 启动排队秒杀放行任务
+	service.StartSeckillQueueAdmitter()
+
+	// 注册支付渠道
+	service.InitPaymentProviders()
+
+	// 启动已取消订单退款重试任务（依赖已注册的支付渠道）
+	service.StartCancelledOrderRefundRetrier()
+
 	// 设置路由
 	r := router.SetupRouter()
 
@@ -101,6 +146,21 @@ func main() {
 	// 停止Stream消费者
 	service.StopStreamConsumers()
 
+	// 停止后台对账任务
+	service.StopSeckillReconciler()
+
+	// 停止支付超时取消任务
+	service.StopOrderPayTimeoutCanceller()
+
+	// 停止库存回补通知订阅
+	service.StopSeckillSoldOutSubscriber()
+
+	// 停止排队放行任务
+	service.StopSeckillQueueAdmitter()
+
+	// 停止已取消订单退款重试任务
+	service.StopCancelledOrderRefundRetrier()
+
 	// 关闭HTTP服务器
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -137,3 +197,38 @@ func initBloomFilters() error {
 
 	return nil
 }
+
+// runCommand 执行命令行子命令
+// 用法: go run main.go [-config=path] reconcile [-repair]
+// 用法: go run main.go [-config=path] warmup-hot-shops
+func runCommand(name string, args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	switch name {
+	case "reconcile":
+		fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+		repair := fs.Bool("repair", false, "Repair Redis seckill state from MySQL when drift is found")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		report, err := service.ReconcileSeckill(ctx, *repair)
+		if err != nil {
+			return err
+		}
+
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(data))
+		return nil
+	case "warmup-hot-shops":
+		warmed, err := service.WarmUpHotShops(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("warmed up %d hot shops\n", warmed)
+		return nil
+	default:
+		return fmt.Errorf("unknown command: %s", name)
+	}
+}
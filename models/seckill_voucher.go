@@ -7,6 +7,8 @@ import "time"
 type SeckillVoucher struct {
 	VoucherID  uint      `gorm:"primaryKey;column:voucher_id" json:"voucherId"` // 关联的优惠券的id
 	Stock      int       `gorm:"column:stock;not null" json:"stock"`            // 库存
+	LimitPerUser int     `gorm:"column:limit_per_user;not null;default:1" json:"limitPerUser"` // 每人限购数量
+	Queued     bool      `gorm:"column:queued;not null;default:false" json:"queued"` // 是否需要排队领取购买许可
 	CreateTime time.Time `gorm:"column:create_time;not null;default:CURRENT_TIMESTAMP" json:"createTime"` // 创建时间
 	BeginTime  time.Time `gorm:"column:begin_time;not null" json:"beginTime"`   // 生效时间
 	EndTime    time.Time `gorm:"column:end_time;not null" json:"endTime"`       // 失效时间
@@ -24,6 +24,8 @@ type Shop struct {
 	Comments  int            `json:"comments"`
 	Score     int            `json:"score"`
 	OpenHours string         `gorm:"size:32" json:"openHours"`
+	OwnerID   uint           `gorm:"index" json:"ownerId"`        // 商铺所属商家的用户ID，0表示未绑定商家
+	Distance  float64        `gorm:"-" json:"distance,omitempty"` // 与用户的距离（米），仅按位置查询时返回
 }
 
 func (Shop) TableName() string {
@@ -8,14 +8,14 @@ import (
 
 // VoucherOrder 优惠券订单模型
 type VoucherOrder struct {
-	ID         uint           `gorm:"primarykey" json:"id"`
+	ID         uint           `gorm:"primarykey" json:"id,string"` // 由RedisIdWorker生成，超出JS安全整数范围，以字符串序列化
 	CreatedAt  time.Time      `json:"createdAt"`
 	UpdatedAt  time.Time      `json:"updatedAt"`
 	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
 	UserID     uint           `json:"userId"`
 	VoucherID  uint           `json:"voucherId"`
 	PayType    int            `json:"payType"`
-	Status     int            `json:"status"`
+	Status     int            `json:"status"` // 1-未支付，2-已支付，3-已核销，4-已取消，5-已退款，6-退款中
 	CreateTime *time.Time     `json:"createTime"`
 	PayTime    *time.Time     `json:"payTime"`
 	UseTime    *time.Time     `json:"useTime"`
@@ -23,8 +23,39 @@ type VoucherOrder struct {
 	UpdateTime *time.Time     `json:"updateTime"`
 	// 券类型标识：1-普通券，2-秒杀券
 	VoucherType int `gorm:"index" json:"voucherType"`
+	// 秒杀订单唯一键，格式为"用户ID:优惠券ID:购买序号"，购买序号取值 1 ~ 每人限购数量，普通券订单为NULL
+	// MySQL不支持部分索引，借助唯一索引允许多个NULL的特性，只对秒杀券实现每人限购约束
+	SeckillKey *string `gorm:"size:64;uniqueIndex:uk_seckill_user_voucher" json:"-"`
+	// 核销码，支付成功时生成：短码供到店手动输入，令牌用于生成二维码，未支付的订单为NULL
+	RedeemCode  *string `gorm:"size:16;uniqueIndex" json:"redeemCode,omitempty"`
+	RedeemToken *string `gorm:"size:64;uniqueIndex" json:"redeemToken,omitempty"`
+	// 核销门店ID，未核销时为0
+	RedeemShopID uint `json:"redeemShopId,omitempty"`
+	// 支付流水号、支付渠道和实付金额，支付成功时记录，退款时通过原支付渠道原路退回
+	PaymentNo   *string `gorm:"size:32" json:"-"`
+	PayProvider string  `gorm:"size:32" json:"-"`
+	PayAmount   int64   `json:"payAmount,omitempty"`
+	// 已取消订单收到延迟到达的支付成功通知时需要原路退款，记录退款进度供失败后重试
+	RefundStatus int `gorm:"index" json:"refundStatus,omitempty"`
 }
 
+// 订单状态
+const (
+	OrderStatusUnpaid    = 1 // 未支付
+	OrderStatusPaid      = 2 // 已支付
+	OrderStatusUsed      = 3 // 已核销
+	OrderStatusCancelled = 4 // 已取消
+	OrderStatusRefunded  = 5 // 已退款
+	OrderStatusRefunding = 6 // 退款中
+)
+
+// 已取消订单的退款状态
+const (
+	RefundStatusNone    = 0 // 无需退款
+	RefundStatusPending = 1 // 待退款
+	RefundStatusDone    = 2 // 已退款
+)
+
 func (VoucherOrder) TableName() string {
 	return "tb_voucher_order"
 }
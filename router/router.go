@@ -38,8 +38,9 @@ func SetupRouter() *gin.Engine {
 			shopGroup.GET("/:id", handler.GetShopById)
 			shopGroup.GET("/of/type", handler.GetShopByType)
 			shopGroup.GET("/of/name", handler.GetShopByName)
-			shopGroup.POST("", handler.SaveShop)
-			shopGroup.PUT("", handler.UpdateShop)
+			shopGroup.POST("", utils.JWTMiddleware(), handler.SaveShop)                 // 商家新增商铺
+			shopGroup.PUT("", utils.JWTMiddleware(), handler.UpdateShop)                // 商家修改商铺
+			shopGroup.DELETE("/:id", utils.JWTMiddleware(), handler.DeleteShop)         // 商家删除商铺
 			shopGroup.GET("/:id/nearby", utils.JWTMiddleware(), handler.GetNearbyShops) // 获取某个商铺附近的商铺
 		}
 
@@ -53,15 +54,31 @@ func SetupRouter() *gin.Engine {
 		voucherGroup := api.Group("/voucher")
 		{
 			voucherGroup.GET("/list/:shopId", handler.GetVoucherList)
-			voucherGroup.POST("", handler.AddVoucher)
-			voucherGroup.POST("/seckill", handler.AddSeckillVoucher)
 			voucherGroup.GET("/seckill/:id", handler.GetSeckillVoucher)
+
+			// 商家管理优惠券，需要是商铺所属商家或管理员
+			voucherGroup.POST("", utils.JWTMiddleware(), handler.AddVoucher)                    // 新增普通券
+			voucherGroup.POST("/seckill", utils.JWTMiddleware(), handler.AddSeckillVoucher)     // 新增秒杀券
+			voucherGroup.PUT("/:id", utils.JWTMiddleware(), handler.UpdateVoucher)              // 修改优惠券信息
+			voucherGroup.PUT("/:id/status", utils.JWTMiddleware(), handler.UpdateVoucherStatus) // 上架/下架
+			voucherGroup.PUT("/:id/time", utils.JWTMiddleware(), handler.UpdateVoucherTime)     // 修改有效期/秒杀时间
+			voucherGroup.PUT("/:id/stock", utils.JWTMiddleware(), handler.AdjustVoucherStock)   // 调整库存
+			voucherGroup.DELETE("/:id", utils.JWTMiddleware(), handler.DeleteVoucher)           // 删除优惠券
 		}
 
 		// 优惠券订单相关路由
 		voucherOrderGroup := api.Group("/voucher-order")
 		{
-			voucherOrderGroup.POST("/seckill/:id", utils.JWTMiddleware(), handler.SeckillVoucher)
+			voucherOrderGroup.POST("/seckill/:id", utils.JWTMiddleware(), utils.SeckillRateLimitMiddleware(), handler.SeckillVoucher) // 秒杀下单（限流）
+			voucherOrderGroup.POST("/seckill/:id/ticket", utils.JWTMiddleware(), handler.IssueSeckillTicket)                          // 领取排队号
+			voucherOrderGroup.GET("/seckill/:id/ticket", utils.JWTMiddleware(), handler.GetSeckillTicket)                             // 查询排队状态
+			voucherOrderGroup.POST("/normal/:id", utils.JWTMiddleware(), handler.BuyNormalVoucher)                                    // 购买普通券
+			voucherOrderGroup.GET("/of/me", utils.JWTMiddleware(), handler.GetMyVoucherOrders)                                        // 我的订单列表
+			voucherOrderGroup.GET("/:id", utils.JWTMiddleware(), handler.GetVoucherOrder)                                             // 查询订单处理状态
+			voucherOrderGroup.POST("/:id/pay", utils.JWTMiddleware(), handler.PayVoucherOrder)                                        // 发起支付
+			voucherOrderGroup.POST("/:id/refund", utils.JWTMiddleware(), handler.RefundVoucherOrder)                                  // 订单退款
+			voucherOrderGroup.POST("/:id/cancel", utils.JWTMiddleware(), handler.CancelVoucherOrder)                                  // 取消订单
+			voucherOrderGroup.POST("/redeem", utils.JWTMiddleware(), handler.RedeemVoucherOrder)                                      // 商家到店核销
 		}
 
 		// 博客相关路由
@@ -83,6 +100,22 @@ func SetupRouter() *gin.Engine {
 			followGroup.GET("/common/:id", utils.JWTMiddleware(), handler.GetCommonFollows)
 		}
 
+		// 支付相关路由
+		payGroup := api.Group("/pay")
+		{
+			payGroup.POST("/callback/:provider", handler.PaymentCallback) // 支付渠道回调，通过签名校验身份，不需要登录
+		}
+
+		// 管理相关路由
+		adminGroup := api.Group("/admin", utils.JWTMiddleware(), utils.AdminMiddleware())
+		{
+			adminGroup.GET("/seckill/dlq", handler.ListSeckillDeadLetters)              // 查看死信队列
+			adminGroup.POST("/seckill/dlq/:id/replay", handler.ReplaySeckillDeadLetter) // 重新投递死信消息
+			adminGroup.DELETE("/seckill/dlq/:id", handler.DiscardSeckillDeadLetter)     // 丢弃死信消息
+			adminGroup.GET("/seckill/reconcile", handler.GetSeckillReconcileReport)     // 最近一次对账结果
+			adminGroup.POST("/seckill/reconcile", handler.RunSeckillReconcile)          // 立即执行对账
+		}
+
 		// 统计相关路由
 		statGroup := api.Group("/stat")
 		{
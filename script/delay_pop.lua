@@ -0,0 +1,9 @@
+-- 从延迟队列中取出已到期的成员并移除，保证多个实例不会重复处理同一成员
+-- KEYS[1] 延迟队列key（zset，score为到期时间的毫秒时间戳）
+-- ARGV[1] 当前时间（毫秒时间戳）
+-- ARGV[2] 单次最多取出的数量
+local members = redis.call('zrangebyscore', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+if(#members > 0) then
+    redis.call('zrem', KEYS[1], unpack(members))
+end
+return members
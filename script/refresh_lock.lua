@@ -0,0 +1,9 @@
+-- 刷新锁的过期时间：只有锁的值与持有者一致时才续期
+-- KEYS[1] 锁key
+-- ARGV[1] 锁的值
+-- ARGV[2] 过期时间（秒）
+if redis.call("get", KEYS[1]) == ARGV[1] then
+    return redis.call("expire", KEYS[1], ARGV[2])
+else
+    return 0
+end
@@ -0,0 +1,66 @@
+// Package script 集中管理项目中使用的Redis Lua脚本
+// 脚本源码通过 embed 编译进二进制，不依赖运行时的工作目录；
+// 执行时优先使用 EVALSHA，Redis 未缓存脚本（NOSCRIPT）时自动回退为 EVAL
+package script
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	//go:embed seckill.lua
+	seckillSource string
+	//go:embed seckill_compensate.lua
+	seckillCompensateSource string
+	//go:embed seckill_stock_adjust.lua
+	seckillStockAdjustSource string
+	//go:embed unlock.lua
+	unlockSource string
+	//go:embed refresh_lock.lua
+	refreshLockSource string
+	//go:embed delay_pop.lua
+	delayPopSource string
+	//go:embed token_bucket.lua
+	tokenBucketSource string
+	//go:embed seckill_queue_admit.lua
+	seckillQueueAdmitSource string
+	//go:embed seckill_reconcile_repair.lua
+	seckillReconcileRepairSource string
+)
+
+// registry 所有已注册的脚本，用于启动时统一预加载
+var registry []*redis.Script
+
+// 已注册的脚本
+var (
+	Seckill                = Register(seckillSource)                // 秒杀资格校验、预扣库存并写入订单Stream
+	SeckillCompensate      = Register(seckillCompensateSource)      // 订单失败后回补库存、释放购买资格
+	SeckillStockAdjust     = Register(seckillStockAdjustSource)     // 商家调整秒杀券库存
+	Unlock                 = Register(unlockSource)                 // 安全释放分布式锁
+	RefreshLock            = Register(refreshLockSource)            // 刷新分布式锁的过期时间
+	DelayPop               = Register(delayPopSource)               // 取出延迟队列中已到期的成员
+	TokenBucket            = Register(tokenBucketSource)            // 令牌桶限流
+	SeckillQueueAdmit      = Register(seckillQueueAdmitSource)      // 排队秒杀按批次放行并发放购买许可
+	SeckillReconcileRepair = Register(seckillReconcileRepairSource) // 对账后使用MySQL数据修复秒杀缓存
+)
+
+// Register 注册脚本，返回可直接执行的脚本对象
+func Register(src string) *redis.Script {
+	s := redis.NewScript(src)
+	registry = append(registry, s)
+	return s
+}
+
+// LoadAll 使用 SCRIPT LOAD 将所有已注册的脚本预加载到Redis
+func LoadAll(ctx context.Context, rdb *redis.Client) error {
+	for _, s := range registry {
+		if err := s.Load(ctx, rdb).Err(); err != nil {
+			return fmt.Errorf("failed to load lua script %s: %w", s.Hash(), err)
+		}
+	}
+	return nil
+}
@@ -1,3 +1,6 @@
+-- 脚本中调用了非确定性命令 TIME，使用命令复制模式（Redis 5.0 之后为默认行为）
+redis.replicate_commands()
+
 -- 1. 参数列表
 -- 1.1 优惠券id
 local voucherId = ARGV[1]
@@ -5,28 +8,71 @@ local voucherId = ARGV[1]
 local userId = ARGV[2]
 -- 1.3 订单id
 local orderId = ARGV[3]
+-- 1.4 是否为死信订单重新投递（'1'），原订单已通过秒杀时间和排队许可校验，重新投递时跳过这两项检查
+local replay = (ARGV[4] == '1')
 
 -- 2. 数据key
 -- 2.1 库存key
 local stockKey = "cache:seckill_voucher:stock:" .. voucherId
--- 2.2 订单key
-local orderKey = "cache:seckill_voucher:order:" .. voucherId
+-- 2.2 用户已购数量key（hash: userId -> 已购数量）
+local purchaseKey = "cache:seckill_voucher:purchase:" .. voucherId
+-- 2.3 订单处理状态key
+local statusKey = "seckill:order:status:" .. orderId
+-- 2.4 秒杀券元信息key（开始/结束时间为毫秒时间戳，limit为每人限购数量，queued为是否排队，status为上下架状态）
+local metaKey = "cache:seckill_voucher:meta:" .. voucherId
+-- 2.5 购买许可key（排队秒杀券放行后发放）
+local permitKey = "seckill:permit:" .. voucherId .. ":" .. userId
 
 
 -- 3. 脚本业务
--- 3.1 判断库存是否充足
-if(tonumber(redis.call('get', stockKey)) <= 0) then
+-- 3.1 判断秒杀券是否已初始化（库存缓存不存在时 get 返回 false）
+local stock = redis.call('get', stockKey)
+local window = redis.call('hmget', metaKey, 'begin', 'end', 'limit', 'status', 'queued')
+if(stock == false or window[1] == false or window[2] == false) then
+    return 3
+end
+-- 3.2 判断秒杀券是否已下架（2-下架，未设置时视为上架）
+if(window[4] == '2') then
+    return 6
+end
+-- 3.3 判断秒杀时间，以Redis服务器时间为准
+if(not replay) then
+    local now = redis.call('time')
+    local nowMs = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+    if(nowMs < tonumber(window[1])) then
+        return 4
+    end
+    if(nowMs > tonumber(window[2])) then
+        return 5
+    end
+end
+-- 3.4 判断库存是否充足
+if(tonumber(stock) <= 0) then
     return 1
 end
--- 3.2 判断用户是否重复下单
-if(redis.call('sismember', orderKey, userId) == 1) then
+-- 3.5 判断用户已购数量是否达到限购数量（未设置时默认一人一单）
+local limit = tonumber(window[3]) or 1
+local bought = tonumber(redis.call('hget', purchaseKey, userId)) or 0
+if(bought >= limit) then
     return 2
 end
+-- 3.6 排队秒杀券需要持有购买许可
+local queued = (window[5] == '1') and not replay
+if(queued and redis.call('exists', permitKey) == 0) then
+    return 7
+end
 
--- 3.3 扣减库存
+-- 3.7 扣减库存
 redis.call('incrby', stockKey, -1)
--- 3.4 下单（保存用户）
-redis.call('sadd', orderKey, userId)
--- 3.5 下单（保存用户）
+-- 3.8 下单（累加用户已购数量）
+redis.call('hincrby', purchaseKey, userId, 1)
+-- 3.9 购买许可只能使用一次
+if(queued) then
+    redis.call('del', permitKey)
+end
+-- 3.10 发送消息到Stream，携带预先生成的订单id
 redis.call('xadd', 'stream.orders', '*', 'userId', userId, 'voucherId', voucherId, 'id', orderId)
+-- 3.11 记录订单处理状态，供客户端轮询（过期时间与 dao.SeckillOrderStatusTTL 保持一致）
+redis.call('hset', statusKey, 'status', 'pending', 'userId', userId, 'voucherId', voucherId)
+redis.call('expire', statusKey, 86400)
 return 0
\ No newline at end of file
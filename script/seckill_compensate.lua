@@ -0,0 +1,40 @@
+-- 1. 参数列表
+-- 1.1 优惠券id
+local voucherId = ARGV[1]
+-- 1.2 用户id
+local userId = ARGV[2]
+-- 1.3 订单id
+local orderId = ARGV[3]
+-- 1.4 补偿原因
+local reason = ARGV[4]
+
+-- 2. 数据key
+-- 2.1 库存key
+local stockKey = "cache:seckill_voucher:stock:" .. voucherId
+-- 2.2 用户已购数量key（hash: userId -> 已购数量）
+local purchaseKey = "cache:seckill_voucher:purchase:" .. voucherId
+-- 2.3 补偿标记key，保证同一订单只补偿一次
+local compensatedKey = "seckill:compensated:" .. orderId
+
+-- 3. 脚本业务
+-- 3.1 判断订单是否已经补偿过
+if(redis.call('set', compensatedKey, '1', 'NX', 'EX', 604800) == false) then
+    return 1
+end
+-- 3.2 扣减用户已购数量，用户没有已购记录说明购买资格已释放，无需回补库存
+local bought = tonumber(redis.call('hget', purchaseKey, userId)) or 0
+if(bought <= 0) then
+    return 2
+end
+if(bought == 1) then
+    redis.call('hdel', purchaseKey, userId)
+else
+    redis.call('hincrby', purchaseKey, userId, -1)
+end
+-- 3.3 回补库存（库存缓存不存在时不创建，交由预热流程从数据库加载）
+if(redis.call('exists', stockKey) == 1) then
+    redis.call('incrby', stockKey, 1)
+end
+-- 3.4 记录补偿，只保留最近约10万条记录（近似裁剪），避免补偿记录无限增长
+redis.call('xadd', 'stream.orders.compensation', 'MAXLEN', '~', 100000, '*', 'userId', userId, 'voucherId', voucherId, 'id', orderId, 'reason', reason)
+return 0
@@ -0,0 +1,30 @@
+-- 秒杀排队放行：按排队顺序取出一批用户并发放限时购买许可
+-- 取出队列与发放许可在同一个脚本中完成，保证出队的用户一定拿到许可
+
+-- 1. 参数列表
+-- 1.1 优惠券id
+local voucherId = ARGV[1]
+-- 1.2 本批放行人数
+local count = tonumber(ARGV[2])
+-- 1.3 购买许可有效期（毫秒）
+local permitTTL = tonumber(ARGV[3])
+
+-- 2. 数据key（与 dao/seckill_queue.go 保持一致）
+-- 2.1 排队队列key（zset: userId -> 排队序号）
+local queueKey = "seckill:queue:" .. voucherId
+-- 2.2 存在排队用户的秒杀券集合key
+local vouchersKey = "seckill:queue:vouchers"
+
+-- 3. 取出排在最前面的用户，发放购买许可
+local popped = redis.call('zpopmin', queueKey, count)
+local admitted = 0
+for i = 1, #popped, 2 do
+    redis.call('set', 'seckill:permit:' .. voucherId .. ':' .. popped[i], '1', 'PX', permitTTL)
+    admitted = admitted + 1
+end
+
+-- 4. 队列已空时不再需要放行
+if(redis.call('zcard', queueKey) == 0) then
+    redis.call('srem', vouchersKey, voucherId)
+end
+return admitted
@@ -0,0 +1,73 @@
+-- 对账修复：使用MySQL数据重建秒杀券的用户已购数量、元信息和库存缓存
+-- 修复前在脚本内重新检查订单消息是否已全部落库、秒杀是否已结束，
+-- 检查与重建在同一个脚本中完成，期间秒杀脚本无法扣减库存，不会覆盖未落库的预扣减
+-- 脚本中调用了非确定性命令 TIME，使用命令复制模式（Redis 5.0 之后为默认行为）
+redis.replicate_commands()
+
+-- 1. 参数列表
+-- 1.1 优惠券id
+local voucherId = ARGV[1]
+-- 1.2 订单Stream名称
+local streamKey = ARGV[2]
+-- 1.3 消费者组名称
+local groupName = ARGV[3]
+-- 1.4 MySQL中的库存
+local stock = ARGV[4]
+-- 1.5 秒杀开始/结束时间（毫秒时间戳）、每人限购数量、是否排队
+local beginMs = tonumber(ARGV[5])
+local endMs = tonumber(ARGV[6])
+local limit = ARGV[7]
+local queued = ARGV[8]
+-- 1.6 之后的参数为 用户id、已购数量 交替排列
+
+-- 2. 数据key（与 dao/seckill_voucher.go 保持一致）
+-- 2.1 库存key
+local stockKey = "cache:seckill_voucher:stock:" .. voucherId
+-- 2.2 用户已购数量key（hash: userId -> 已购数量）
+local purchaseKey = "cache:seckill_voucher:purchase:" .. voucherId
+-- 2.3 秒杀券元信息key
+local metaKey = "cache:seckill_voucher:meta:" .. voucherId
+
+-- 3. 检查是否可以修复
+-- 3.1 秒杀进行中时库存随时在变化，不修复
+local now = redis.call('time')
+local nowMs = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+if(nowMs >= beginMs and nowMs <= endMs) then
+    return 3
+end
+-- 3.2 存在已投递但未确认的订单消息
+if(redis.call('exists', streamKey) == 1) then
+    local lastDelivered = nil
+    local groups = redis.call('xinfo', 'groups', streamKey)
+    for _, group in ipairs(groups) do
+        local info = {}
+        for i = 1, #group, 2 do
+            info[group[i]] = group[i + 1]
+        end
+        if(info['name'] == groupName) then
+            if(tonumber(info['pending']) > 0) then
+                return 1
+            end
+            lastDelivered = info['last-delivered-id']
+        end
+    end
+    -- 3.3 存在尚未投递给消费者组的订单消息（消费者组不存在时所有消息都未投递）
+    local undelivered
+    if(lastDelivered == nil) then
+        undelivered = redis.call('xrange', streamKey, '-', '+', 'COUNT', 1)
+    else
+        undelivered = redis.call('xrange', streamKey, '(' .. lastDelivered, '+', 'COUNT', 1)
+    end
+    if(#undelivered > 0) then
+        return 2
+    end
+end
+
+-- 4. 重建缓存
+redis.call('del', purchaseKey)
+for i = 9, #ARGV, 2 do
+    redis.call('hset', purchaseKey, ARGV[i], ARGV[i + 1])
+end
+redis.call('hset', metaKey, 'begin', beginMs, 'end', endMs, 'limit', limit, 'queued', queued)
+redis.call('set', stockKey, stock)
+return 0
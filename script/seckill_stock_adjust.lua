@@ -0,0 +1,23 @@
+-- 1. 参数列表
+-- 1.1 优惠券id
+local voucherId = ARGV[1]
+-- 1.2 库存调整量，负数表示减少库存
+local delta = tonumber(ARGV[2])
+
+-- 2. 数据key
+-- 2.1 库存key
+local stockKey = "cache:seckill_voucher:stock:" .. voucherId
+
+-- 3. 脚本业务
+-- 3.1 库存缓存不存在时不创建，交由预热流程从数据库加载
+local stock = redis.call('get', stockKey)
+if(stock == false) then
+    return 1
+end
+-- 3.2 减少库存时，剩余库存（已扣除预扣减部分）必须足够
+if(tonumber(stock) + delta < 0) then
+    return 2
+end
+-- 3.3 调整库存
+redis.call('incrby', stockKey, delta)
+return 0
@@ -0,0 +1,42 @@
+-- 令牌桶限流：所有桶都有足够令牌时才同时扣减，否则不扣减任何桶
+-- 脚本中调用了非确定性命令 TIME，使用命令复制模式（Redis 5.0 之后为默认行为）
+redis.replicate_commands()
+
+-- KEYS[i]           第i个令牌桶key（hash: tokens 剩余令牌数, ts 上次更新时间毫秒时间戳）
+-- ARGV[2*i-1]       第i个令牌桶每秒生成的令牌数
+-- ARGV[2*i]         第i个令牌桶容量
+-- 返回值：0 表示放行，大于0表示需要等待的毫秒数
+
+-- 1. 以Redis服务器时间为准，避免多个实例时钟不一致
+local now = redis.call('time')
+local nowMs = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+
+-- 2. 计算每个桶当前的令牌数
+local tokens = {}
+local wait = 0
+for i, key in ipairs(KEYS) do
+    local rate = tonumber(ARGV[2 * i - 1])
+    local capacity = tonumber(ARGV[2 * i])
+    local bucket = redis.call('hmget', key, 'tokens', 'ts')
+    local last = tonumber(bucket[1]) or capacity
+    local ts = tonumber(bucket[2]) or nowMs
+    local current = math.min(capacity, last + math.max(0, nowMs - ts) * rate / 1000)
+    tokens[i] = current
+    if(current < 1) then
+        wait = math.max(wait, math.ceil((1 - current) * 1000 / rate))
+    end
+end
+
+-- 3. 任意一个桶令牌不足时拒绝
+if(wait > 0) then
+    return wait
+end
+
+-- 4. 扣减令牌，桶在回满之后即可过期
+for i, key in ipairs(KEYS) do
+    local rate = tonumber(ARGV[2 * i - 1])
+    local capacity = tonumber(ARGV[2 * i])
+    redis.call('hset', key, 'tokens', tokens[i] - 1, 'ts', nowMs)
+    redis.call('pexpire', key, math.ceil(capacity * 1000 / rate) + 1000)
+end
+return 0
@@ -0,0 +1,8 @@
+-- 安全释放锁：只有锁的值与持有者一致时才删除
+-- KEYS[1] 锁key
+-- ARGV[1] 锁的值
+if redis.call("get", KEYS[1]) == ARGV[1] then
+    return redis.call("del", KEYS[1])
+else
+    return 0
+end
@@ -2,12 +2,12 @@ package service
 
 import (
 	"context"
+	"errors"
 	"hm-dianping-go/dao"
 	"hm-dianping-go/models"
 	"hm-dianping-go/utils"
+	"log"
 	"strconv"
-
-	"gorm.io/gorm"
 )
 
 // CreateBlog 创建博客
@@ -53,11 +53,13 @@ func LikeBlog(ctx context.Context, userId, blogId uint) *utils.Result {
 			if err := dao.DecrementBlogLiked(ctx, blogId); err != nil {
 				return utils.ErrorResult("更新点赞数失败")
 			}
+			deleteBlogCache(ctx, blogId)
 			return utils.SuccessResult("取消点赞成功")
 		}
 		if err := dao.IncrementBlogLiked(ctx, blogId); err != nil {
 			return utils.ErrorResult("更新点赞数失败")
 		}
+		deleteBlogCache(ctx, blogId)
 		// 保存用户 id 到 redis 集合
 		if err := dao.SaveLikedMember(ctx, dao.Redis, userId, blogId); err != nil {
 			return utils.ErrorResult("保存点赞失败")
@@ -67,6 +69,13 @@ func LikeBlog(ctx context.Context, userId, blogId uint) *utils.Result {
 	return utils.ErrorResult("点赞失败")
 }
 
+// deleteBlogCache 博客点赞数变化后删除博客详情缓存，失败只记录日志
+func deleteBlogCache(ctx context.Context, blogId uint) {
+	if err := blogCache().Delete(ctx, blogId); err != nil {
+		log.Printf("删除博客缓存失败: blogId=%d, error=%v", blogId, err)
+	}
+}
+
 // GetBlogList 获取博客列表
 func GetBlogList(ctx context.Context, page, size int) *utils.Result {
 	offset := (page - 1) * size
@@ -86,9 +95,9 @@ func GetBlogList(ctx context.Context, page, size int) *utils.Result {
 
 // GetBlogById 根据ID获取博客
 func GetBlogById(ctx context.Context, id uint, userId uint) *utils.Result {
-	blog, err := dao.GetBlogByID(ctx, id)
+	blog, err := blogCache().QueryWithPassThrough(ctx, id, dao.GetBlogByID)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
+		if errors.Is(err, utils.ErrCacheNotFound) {
 			return utils.ErrorResult("博客不存在")
 		}
 		return utils.ErrorResult("查询失败")
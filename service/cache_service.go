@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"hm-dianping-go/config"
+	"hm-dianping-go/dao"
+	"hm-dianping-go/models"
+	"hm-dianping-go/utils"
+	"time"
+)
+
+// 实体缓存配置
+var (
+	shopCacheOptions = utils.CacheOptions{
+		KeyPrefix: dao.ShopCache,
+		TTL:       time.Hour,
+		NullTTL:   2 * time.Minute,
+		BloomKey:  utils.ShopBloomConfig.Key,
+	}
+	shopTypeCacheOptions = utils.CacheOptions{
+		KeyPrefix: dao.ShopTypeCache,
+		TTL:       time.Hour,
+	}
+	blogCacheOptions = utils.CacheOptions{
+		KeyPrefix: dao.BlogCache,
+		TTL:       30 * time.Minute,
+		NullTTL:   2 * time.Minute,
+	}
+	userCacheOptions = utils.CacheOptions{
+		KeyPrefix: dao.UserCache,
+		TTL:       30 * time.Minute,
+		NullTTL:   2 * time.Minute,
+	}
+)
+
+// hotShopCache 热点商铺缓存，使用逻辑过期，过期后返回旧数据并异步重建
+func hotShopCache() *utils.CacheClient[uint, *models.Shop] {
+	return utils.NewCacheClient[uint, *models.Shop](dao.Redis, utils.CacheOptions{
+		KeyPrefix: dao.HotShopCache,
+		TTL:       time.Duration(config.GetConfig().Cache.HotShopTTL) * time.Second,
+		BloomKey:  utils.ShopBloomConfig.Key,
+	})
+}
+
+// shopTypeListCacheID 商铺类型列表只有一份缓存
+const shopTypeListCacheID = "list"
+
+// shopCache 商铺详情缓存
+func shopCache() *utils.CacheClient[uint, *models.Shop] {
+	return utils.NewCacheClient[uint, *models.Shop](dao.Redis, shopCacheOptions)
+}
+
+// shopTypeCache 商铺类型列表缓存
+func shopTypeCache() *utils.CacheClient[string, []*models.ShopType] {
+	return utils.NewCacheClient[string, []*models.ShopType](dao.Redis, shopTypeCacheOptions)
+}
+
+// blogCache 博客详情缓存
+func blogCache() *utils.CacheClient[uint, *models.Blog] {
+	return utils.NewCacheClient[uint, *models.Blog](dao.Redis, blogCacheOptions)
+}
+
+// userCache 用户信息缓存
+func userCache() *utils.CacheClient[uint, *models.User] {
+	return utils.NewCacheClient[uint, *models.User](dao.Redis, userCacheOptions)
+}
+
+// loadShop 从数据库加载商铺
+func loadShop(ctx context.Context, id uint) (*models.Shop, error) {
+	return dao.GetShopById(ctx, dao.DB, id)
+}
+
+// loadShopTypeList 从数据库加载商铺类型列表
+func loadShopTypeList(ctx context.Context, _ string) ([]*models.ShopType, error) {
+	return dao.GetShopTypeList(ctx, dao.DB)
+}
+
+// loadUser 从数据库加载用户
+func loadUser(_ context.Context, id uint) (*models.User, error) {
+	return dao.GetUserByID(id)
+}
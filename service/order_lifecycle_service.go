@@ -0,0 +1,332 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hm-dianping-go/dao"
+	"hm-dianping-go/models"
+	"hm-dianping-go/utils"
+	"log"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// orderTransitions 订单状态机，记录每个状态允许流转到的目标状态
+// 未支付 -> 已支付 / 已取消；已支付 -> 已核销 / 退款中；退款中 -> 已退款 / 已支付（渠道退款失败时恢复）
+// 已核销、已取消、已退款为终态
+var orderTransitions = map[int][]int{
+	models.OrderStatusUnpaid:    {models.OrderStatusPaid, models.OrderStatusCancelled},
+	models.OrderStatusPaid:      {models.OrderStatusUsed, models.OrderStatusRefunding},
+	models.OrderStatusRefunding: {models.OrderStatusRefunded, models.OrderStatusPaid},
+}
+
+// errOrderStatusChanged 订单状态在校验之后被并发修改
+var errOrderStatusChanged = errors.New("订单状态已变更")
+
+// canTransitOrderStatus 判断订单能否从 from 状态流转到 to 状态
+func canTransitOrderStatus(from, to int) bool {
+	for _, status := range orderTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// orderRefundLockKey 订单退款锁，同一订单同一时间只处理一个退款请求
+const orderRefundLockKey = "lock:order:refund:"
+
+// orderRefundLockTTL 订单退款锁的过期时间，需要覆盖支付渠道退款的耗时
+const orderRefundLockTTL = 30 * time.Second
+
+// RefundVoucherOrder 已支付订单退款：先将订单置为退款中，再通过原支付渠道退款，渠道确认成功后更新为已退款并退还库存
+// 退款中的订单无法核销，渠道退款失败时恢复为已支付；停留在退款中的订单可以再次申请退款，渠道按退款单号保证幂等
+func RefundVoucherOrder(ctx context.Context, userId, orderId uint) *utils.Result {
+	lockKey := orderRefundLockKey + strconv.FormatUint(uint64(orderId), 10)
+	ok, lockValue := utils.TryLockWithTTL(ctx, dao.Redis, lockKey, orderRefundLockTTL)
+	if !ok {
+		return utils.ErrorResult("退款处理中，请勿重复提交")
+	}
+	defer utils.UnLockSafe(ctx, dao.Redis, lockKey, lockValue)
+
+	order, err := dao.GetVoucherOrderByID(ctx, dao.DB, orderId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResult("订单不存在")
+		}
+		log.Printf("查询订单失败: orderId=%d, error=%v", orderId, err)
+		return utils.ErrorResult("系统错误")
+	}
+	if order.UserID != userId {
+		return utils.ErrorResult("订单不存在")
+	}
+	if order.Status != models.OrderStatusRefunding {
+		if !canTransitOrderStatus(order.Status, models.OrderStatusRefunding) {
+			return utils.ErrorResult("当前订单状态不允许该操作")
+		}
+		// 与核销通过订单状态CAS互斥，已核销的券不会再退款，退款中的券也无法再核销
+		if err := transitVoucherOrder(ctx, order, models.OrderStatusRefunding, nil); err != nil {
+			if errors.Is(err, errOrderStatusChanged) {
+				return utils.ErrorResult("订单状态已变更，请刷新后重试")
+			}
+			log.Printf("更新订单为退款中失败: orderId=%d, error=%v", orderId, err)
+			return utils.ErrorResult("系统错误")
+		}
+	}
+
+	if err := refundOrderPayment(ctx, order); err != nil {
+		log.Printf("支付渠道退款失败: orderId=%d, provider=%s, error=%v", orderId, order.PayProvider, err)
+		if err := transitVoucherOrder(ctx, order, models.OrderStatusPaid, nil); err != nil {
+			log.Printf("恢复订单为已支付失败，订单保持退款中: orderId=%d, error=%v", orderId, err)
+		}
+		return utils.ErrorResult("退款失败，请稍后重试")
+	}
+
+	if err := transitVoucherOrder(ctx, order, models.OrderStatusRefunded, nil); err != nil {
+		// 支付渠道已经退款，订单状态需要人工处理
+		log.Printf("支付渠道已退款但更新订单状态失败，需要人工处理: orderId=%d, error=%v", orderId, err)
+		if errors.Is(err, errOrderStatusChanged) {
+			return utils.ErrorResult("订单状态已变更，请联系客服")
+		}
+		return utils.ErrorResult("系统错误")
+	}
+
+	return utils.SuccessResultWithData(order)
+}
+
+// CancelVoucherOrder 取消未支付的订单，退还库存
+func CancelVoucherOrder(ctx context.Context, userId, orderId uint) *utils.Result {
+	return changeVoucherOrderStatus(ctx, userId, orderId, models.OrderStatusCancelled)
+}
+
+// RedeemVoucherOrderRequest 到店核销请求结构，核销短码和令牌二选一
+type RedeemVoucherOrderRequest struct {
+	ShopID uint   `json:"shopId" binding:"required"`
+	Code   string `json:"code"`  // 核销短码，手动输入
+	Token  string `json:"token"` // 核销令牌，扫描二维码获得
+}
+
+// RedeemVoucherOrder 商家凭核销码核销已支付的订单，订单状态CAS保证同一张券只能核销一次
+func RedeemVoucherOrder(ctx context.Context, userId uint, req *RedeemVoucherOrderRequest) *utils.Result {
+	if req.Code == "" && req.Token == "" {
+		return utils.ErrorResult("核销码不能为空")
+	}
+	if res := checkShopManager(ctx, userId, req.ShopID); res != nil {
+		return res
+	}
+
+	var order *models.VoucherOrder
+	var err error
+	if req.Token != "" {
+		order, err = dao.GetVoucherOrderByRedeemToken(ctx, dao.DB, req.Token)
+	} else {
+		order, err = dao.GetVoucherOrderByRedeemCode(ctx, dao.DB, req.Code)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResult("核销码无效")
+		}
+		log.Printf("查询核销订单失败: error=%v", err)
+		return utils.ErrorResult("系统错误")
+	}
+
+	// 优惠券被删除不影响已购买的券，查询时包含已删除的优惠券
+	voucher, err := dao.GetVoucherByID(ctx, dao.DB.Unscoped(), order.VoucherID)
+	if err != nil {
+		log.Printf("查询优惠券失败: voucherId=%d, error=%v", order.VoucherID, err)
+		return utils.ErrorResult("系统错误")
+	}
+	if voucher.ShopID != req.ShopID {
+		return utils.ErrorResult("该优惠券不属于本店")
+	}
+
+	switch order.Status {
+	case models.OrderStatusPaid:
+	case models.OrderStatusUsed:
+		return utils.ErrorResult("该券已核销")
+	case models.OrderStatusRefunding:
+		return utils.ErrorResult("该券正在退款，无法核销")
+	default:
+		return utils.ErrorResult("当前订单状态不允许核销")
+	}
+
+	if err := transitVoucherOrder(ctx, order, models.OrderStatusUsed, map[string]interface{}{
+		"redeem_shop_id": req.ShopID,
+	}); err != nil {
+		if errors.Is(err, errOrderStatusChanged) {
+			return utils.ErrorResult("订单状态已变更，请刷新后重试")
+		}
+		log.Printf("核销订单失败: orderId=%d, error=%v", order.ID, err)
+		return utils.ErrorResult("系统错误")
+	}
+	order.RedeemShopID = req.ShopID
+
+	return utils.SuccessResultWithData(order)
+}
+
+// changeVoucherOrderStatus 校验订单归属和状态流转后更新订单状态
+func changeVoucherOrderStatus(ctx context.Context, userId, orderId uint, to int) *utils.Result {
+	order, err := dao.GetVoucherOrderByID(ctx, dao.DB, orderId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResult("订单不存在")
+		}
+		log.Printf("查询订单失败: orderId=%d, error=%v", orderId, err)
+		return utils.ErrorResult("系统错误")
+	}
+	if order.UserID != userId {
+		return utils.ErrorResult("订单不存在")
+	}
+	if !canTransitOrderStatus(order.Status, to) {
+		return utils.ErrorResult("当前订单状态不允许该操作")
+	}
+
+	if err := transitVoucherOrder(ctx, order, to, nil); err != nil {
+		if errors.Is(err, errOrderStatusChanged) {
+			return utils.ErrorResult("订单状态已变更，请刷新后重试")
+		}
+		log.Printf("更新订单状态失败: orderId=%d, to=%d, error=%v", orderId, to, err)
+		return utils.ErrorResult("系统错误")
+	}
+
+	return utils.SuccessResultWithData(order)
+}
+
+// transitVoucherOrder 将订单流转到目标状态，extra 为随状态一起更新的其他字段
+// 支付时生成核销码（退款失败恢复为已支付时沿用原核销码），取消和退款时退还MySQL与Redis中的库存；
+// 成功后 order 会被更新为流转后的状态
+func transitVoucherOrder(ctx context.Context, order *models.VoucherOrder, to int, extra map[string]interface{}) error {
+	if !canTransitOrderStatus(order.Status, to) {
+		return fmt.Errorf("订单状态不允许从 %d 流转到 %d", order.Status, to)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"update_time": now}
+	for k, v := range extra {
+		updates[k] = v
+	}
+	releaseStock := false
+	var redeemCode, redeemToken string
+	paying := to == models.OrderStatusPaid && order.Status == models.OrderStatusUnpaid
+	switch to {
+	case models.OrderStatusPaid:
+		if paying {
+			updates["pay_time"] = now
+			var err error
+			if redeemCode, redeemToken, err = generateRedeemCode(); err != nil {
+				return fmt.Errorf("生成核销码失败: %v", err)
+			}
+			updates["redeem_code"] = redeemCode
+			updates["redeem_token"] = redeemToken
+		}
+	case models.OrderStatusUsed:
+		updates["use_time"] = now
+	case models.OrderStatusRefunded:
+		updates["refund_time"] = now
+		releaseStock = true
+	case models.OrderStatusCancelled:
+		releaseStock = true
+	}
+	// 释放秒杀订单占用的购买序号，用户可以再次购买
+	if releaseStock && order.VoucherType == 2 {
+		updates["seckill_key"] = nil
+	}
+
+	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("开始事务失败: %v", tx.Error)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := dao.TransitVoucherOrderStatus(ctx, tx, order.ID, order.Status, to, updates); err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errOrderStatusChanged
+		}
+		return fmt.Errorf("更新订单状态失败: %v", err)
+	}
+
+	if releaseStock {
+		var err error
+		if order.VoucherType == 2 {
+			err = dao.IncrSeckillVoucherStock(ctx, tx, order.VoucherID, 1)
+		} else {
+			err = dao.IncrVoucherStock(ctx, tx, order.VoucherID, 1)
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("退还库存失败: %v", err)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("提交事务失败: %v", err)
+	}
+
+	from := order.Status
+	order.Status = to
+	order.UpdateTime = &now
+	switch to {
+	case models.OrderStatusPaid:
+		if paying {
+			order.PayTime = &now
+			order.RedeemCode = &redeemCode
+			order.RedeemToken = &redeemToken
+		}
+	case models.OrderStatusUsed:
+		order.UseTime = &now
+	case models.OrderStatusRefunded:
+		order.RefundTime = &now
+	}
+	if releaseStock && order.VoucherType == 2 {
+		order.SeckillKey = nil
+	}
+	log.Printf("订单状态已更新: orderId=%d, %d -> %d", order.ID, from, to)
+
+	// 订单已离开未支付状态，移出支付超时队列
+	if from == models.OrderStatusUnpaid {
+		if err := dao.RemoveOrderPayTimeout(ctx, dao.Redis, order.ID); err != nil {
+			log.Printf("移出支付超时队列失败: orderId=%d, error=%v", order.ID, err)
+		}
+	}
+
+	// 秒杀订单还需要退还Redis库存和用户购买资格
+	// 数据库已经提交，Redis回补失败只记录日志，由对账任务修复
+	if releaseStock && order.VoucherType == 2 {
+		reason := "cancel"
+		if to == models.OrderStatusRefunded {
+			reason = "refund"
+		}
+		if err := compensateSeckillOrder(ctx, order.VoucherID, order.UserID, order.ID, reason); err != nil {
+			log.Printf("退还Redis秒杀库存失败: orderId=%d, error=%v", order.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// 核销码长度
+const (
+	redeemCodeLength  = 12 // 核销短码长度（纯数字，便于手动输入）
+	redeemTokenLength = 32 // 核销令牌长度（用于生成二维码）
+)
+
+// generateRedeemCode 生成核销短码和令牌，唯一性由数据库唯一索引保证
+func generateRedeemCode() (string, string, error) {
+	code, err := utils.GenerateSecureRandomCode(redeemCodeLength)
+	if err != nil {
+		return "", "", err
+	}
+	token, err := utils.GenerateSecureRandomString(redeemTokenLength, utils.AlphaNumCharset)
+	if err != nil {
+		return "", "", err
+	}
+	return code, token, nil
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"hm-dianping-go/models"
+	"testing"
+)
+
+func TestCanTransitOrderStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		from int
+		to   int
+		want bool
+	}{
+		{"未支付 -> 已支付", models.OrderStatusUnpaid, models.OrderStatusPaid, true},
+		{"未支付 -> 已取消", models.OrderStatusUnpaid, models.OrderStatusCancelled, true},
+		{"未支付 -> 已核销", models.OrderStatusUnpaid, models.OrderStatusUsed, false},
+		{"未支付 -> 退款中", models.OrderStatusUnpaid, models.OrderStatusRefunding, false},
+		{"未支付 -> 已退款", models.OrderStatusUnpaid, models.OrderStatusRefunded, false},
+		{"已支付 -> 已核销", models.OrderStatusPaid, models.OrderStatusUsed, true},
+		{"已支付 -> 退款中", models.OrderStatusPaid, models.OrderStatusRefunding, true},
+		{"已支付 -> 已退款（必须经过退款中）", models.OrderStatusPaid, models.OrderStatusRefunded, false},
+		{"已支付 -> 已取消", models.OrderStatusPaid, models.OrderStatusCancelled, false},
+		{"已支付 -> 未支付", models.OrderStatusPaid, models.OrderStatusUnpaid, false},
+		{"退款中 -> 已退款", models.OrderStatusRefunding, models.OrderStatusRefunded, true},
+		{"退款中 -> 已支付（渠道退款失败）", models.OrderStatusRefunding, models.OrderStatusPaid, true},
+		{"退款中 -> 已核销", models.OrderStatusRefunding, models.OrderStatusUsed, false},
+		{"已核销 -> 退款中", models.OrderStatusUsed, models.OrderStatusRefunding, false},
+		{"已核销 -> 已退款", models.OrderStatusUsed, models.OrderStatusRefunded, false},
+		{"已取消 -> 已支付", models.OrderStatusCancelled, models.OrderStatusPaid, false},
+		{"已退款 -> 已支付", models.OrderStatusRefunded, models.OrderStatusPaid, false},
+		{"相同状态", models.OrderStatusPaid, models.OrderStatusPaid, false},
+		{"未知状态", 0, models.OrderStatusPaid, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canTransitOrderStatus(tt.from, tt.to); got != tt.want {
+				t.Errorf("canTransitOrderStatus(%d, %d) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerminalOrderStatusHasNoTransitions(t *testing.T) {
+	for _, status := range []int{models.OrderStatusUsed, models.OrderStatusCancelled, models.OrderStatusRefunded} {
+		if next := orderTransitions[status]; len(next) != 0 {
+			t.Errorf("终态 %d 不应允许流转，实际允许流转到 %v", status, next)
+		}
+	}
+}
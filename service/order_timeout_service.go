@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"hm-dianping-go/config"
+	"hm-dianping-go/dao"
+	"hm-dianping-go/models"
+	"hm-dianping-go/script"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 支付超时取消相关配置
+const (
+	payTimeoutPollInterval = time.Second      // 延迟队列轮询间隔
+	payTimeoutBatchSize    = 100              // 单次最多取出的到期订单数
+	payTimeoutRetryDelay   = 10 * time.Second // 取消失败后重新入队的延迟
+	payTimeoutRestoreBatch = 500              // 启动时从数据库恢复延迟任务的分页大小
+)
+
+// 支付超时取消任务状态
+var (
+	payTimeoutStopChan = make(chan struct{}) // 停止信号
+	payTimeoutWg       sync.WaitGroup
+)
+
+// orderPayDeadline 订单的支付截止时间：下单时间加上支付超时时间
+func orderPayDeadline(order *models.VoucherOrder) time.Time {
+	createTime := time.Now()
+	if order.CreateTime != nil {
+		createTime = *order.CreateTime
+	} else if !order.CreatedAt.IsZero() {
+		createTime = order.CreatedAt
+	}
+	return createTime.Add(time.Duration(config.GetConfig().Seckill.PayTimeout) * time.Second)
+}
+
+// scheduleOrderPayTimeout 将未支付的订单加入支付超时延迟队列，到达支付截止时间后自动取消
+func scheduleOrderPayTimeout(ctx context.Context, order *models.VoucherOrder) {
+	deadline := orderPayDeadline(order)
+	if err := dao.AddOrderPayTimeout(ctx, dao.Redis, order.ID, deadline); err != nil {
+		log.Printf("加入支付超时队列失败: orderId=%d, error=%v", order.ID, err)
+	}
+}
+
+// StartOrderPayTimeoutCanceller 启动支付超时取消任务，定期取消超时未支付的秒杀订单并退还库存
+func StartOrderPayTimeoutCanceller() {
+	// 订单落库后、写入延迟队列前进程退出会丢失超时任务，启动时从数据库补齐
+	if err := restoreOrderPayTimeouts(context.Background()); err != nil {
+		log.Printf("恢复支付超时任务失败: %v", err)
+	}
+
+	payTimeoutWg.Add(1)
+	go func() {
+		defer payTimeoutWg.Done()
+
+		ticker := time.NewTicker(payTimeoutPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-payTimeoutStopChan:
+				log.Println("支付超时取消任务收到停止信号，正在退出")
+				return
+			case <-ticker.C:
+				// 到期订单较多时连续处理，直到取不满一批；每批之间检查停止信号，避免积压时阻塞关闭
+				for {
+					select {
+					case <-payTimeoutStopChan:
+						log.Println("支付超时取消任务收到停止信号，正在退出")
+						return
+					default:
+					}
+					n, err := cancelExpiredOrders(context.Background())
+					if err != nil {
+						log.Printf("处理支付超时订单失败: %v", err)
+						break
+					}
+					if n < payTimeoutBatchSize {
+						break
+					}
+				}
+			}
+		}
+	}()
+
+	log.Printf("支付超时取消任务已启动，支付超时时间: %ds", config.GetConfig().Seckill.PayTimeout)
+}
+
+// StopOrderPayTimeoutCanceller 停止支付超时取消任务
+func StopOrderPayTimeoutCanceller() {
+	close(payTimeoutStopChan)
+	payTimeoutWg.Wait()
+}
+
+// restoreOrderPayTimeouts 将数据库中所有未支付的秒杀订单重新加入延迟队列（已在队列中的保持不变）
+func restoreOrderPayTimeouts(ctx context.Context) error {
+	var afterID uint
+	restored := 0
+	for {
+		orders, err := dao.GetUnpaidSeckillOrders(ctx, dao.DB, afterID, payTimeoutRestoreBatch)
+		if err != nil {
+			return err
+		}
+		for i := range orders {
+			scheduleOrderPayTimeout(ctx, &orders[i])
+		}
+		restored += len(orders)
+
+		if len(orders) < payTimeoutRestoreBatch {
+			break
+		}
+		afterID = orders[len(orders)-1].ID
+	}
+
+	log.Printf("支付超时任务恢复完成: 未支付秒杀订单=%d", restored)
+	return nil
+}
+
+// cancelExpiredOrders 取出已到期的订单并逐个取消，返回本次取出的订单数量
+func cancelExpiredOrders(ctx context.Context) (int, error) {
+	members, err := script.DelayPop.Run(ctx, dao.Redis, []string{dao.OrderPayTimeoutQueue},
+		time.Now().UnixMilli(), payTimeoutBatchSize).StringSlice()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, member := range members {
+		orderID, err := strconv.ParseUint(member, 10, 64)
+		if err != nil {
+			log.Printf("支付超时队列中的订单ID无效，已丢弃: %s", member)
+			continue
+		}
+		if err := cancelExpiredOrder(ctx, uint(orderID)); err != nil {
+			log.Printf("取消超时订单失败，稍后重试: orderId=%d, error=%v", orderID, err)
+			if err := dao.AddOrderPayTimeout(ctx, dao.Redis, uint(orderID), time.Now().Add(payTimeoutRetryDelay)); err != nil {
+				log.Printf("超时订单重新入队失败: orderId=%d, error=%v", orderID, err)
+			}
+		}
+	}
+	return len(members), nil
+}
+
+// cancelExpiredOrder 取消超时未支付的订单，订单已支付或已取消时直接跳过
+func cancelExpiredOrder(ctx context.Context, orderID uint) error {
+	order, err := dao.GetVoucherOrderByID(ctx, dao.DB, orderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("超时订单不存在，跳过: orderId=%d", orderID)
+			return nil
+		}
+		return err
+	}
+	if order.Status != models.OrderStatusUnpaid {
+		return nil
+	}
+
+	// 与用户支付并发时由状态CAS保证只有一方成功
+	if err := transitVoucherOrder(ctx, order, models.OrderStatusCancelled, nil); err != nil {
+		if errors.Is(err, errOrderStatusChanged) {
+			return nil
+		}
+		return err
+	}
+
+	log.Printf("订单超时未支付，已自动取消: orderId=%d", orderID)
+	return nil
+}
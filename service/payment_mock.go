@@ -0,0 +1,123 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hm-dianping-go/config"
+	"hm-dianping-go/dao"
+	"log"
+	"net/http"
+	"time"
+)
+
+// 模拟支付相关配置
+const (
+	mockPaymentName            = "mock"
+	mockPaymentSignatureHeader = "X-Mock-Signature" // 回调签名请求头，值为请求体的 HMAC-SHA256 十六进制编码
+	mockPaymentMaxNotify       = 3                  // 回调最多发送次数
+	mockPaymentRetryInterval   = 5 * time.Second    // 回调失败后的重试间隔
+)
+
+// mockPaymentProvider 本地模拟支付渠道，发起支付后等待一段时间自动回调支付成功，用于开发和测试
+type mockPaymentProvider struct{}
+
+// mockPaymentClient 模拟支付发送回调使用的HTTP客户端
+var mockPaymentClient = &http.Client{Timeout: 5 * time.Second}
+
+// Name 渠道名称
+func (p *mockPaymentProvider) Name() string {
+	return mockPaymentName
+}
+
+// CreateSession 发起模拟支付，异步回调支付成功
+func (p *mockPaymentProvider) CreateSession(ctx context.Context, session *dao.PaymentSession) error {
+	body, err := json.Marshal(&PaymentNotification{
+		PaymentNo: session.PaymentNo,
+		OrderID:   session.OrderID,
+		Amount:    session.Amount,
+		Success:   true,
+	})
+	if err != nil {
+		return err
+	}
+
+	cfg := config.GetConfig().Payment
+	go p.notify(cfg.CallbackURL, body, time.Duration(cfg.MockDelay)*time.Second)
+	return nil
+}
+
+// ParseCallback 校验回调签名并解析支付结果
+func (p *mockPaymentProvider) ParseCallback(header http.Header, body []byte) (*PaymentNotification, error) {
+	signature, err := hex.DecodeString(header.Get(mockPaymentSignatureHeader))
+	if err != nil || !hmac.Equal(signature, mockPaymentSign(body)) {
+		return nil, errors.New("签名无效")
+	}
+
+	var notification PaymentNotification
+	if err := json.Unmarshal(body, &notification); err != nil {
+		return nil, fmt.Errorf("回调内容无效: %v", err)
+	}
+	return &notification, nil
+}
+
+// Refund 模拟退款，直接确认退款成功
+func (p *mockPaymentProvider) Refund(ctx context.Context, refund *PaymentRefund) error {
+	log.Printf("模拟退款成功: refundNo=%s, paymentNo=%s, orderId=%d, amount=%d",
+		refund.RefundNo, refund.PaymentNo, refund.OrderID, refund.Amount)
+	return nil
+}
+
+// notify 等待 delay 后发送签名回调，回调未成功时重试
+func (p *mockPaymentProvider) notify(callbackURL string, body []byte, delay time.Duration) {
+	time.Sleep(delay)
+
+	for i := 1; i <= mockPaymentMaxNotify; i++ {
+		err := p.post(callbackURL, body)
+		if err == nil {
+			return
+		}
+		log.Printf("模拟支付回调失败(%d/%d): %v", i, mockPaymentMaxNotify, err)
+		time.Sleep(mockPaymentRetryInterval)
+	}
+}
+
+// post 发送一次签名回调，回调接口返回成功时返回 nil
+func (p *mockPaymentProvider) post(callbackURL string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(mockPaymentSignatureHeader, hex.EncodeToString(mockPaymentSign(body)))
+
+	resp, err := mockPaymentClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success  bool   `json:"success"`
+		ErrorMsg string `json:"errorMsg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("解析回调响应失败: status=%d, error=%v", resp.StatusCode, err)
+	}
+	if !result.Success {
+		return errors.New(result.ErrorMsg)
+	}
+	return nil
+}
+
+// mockPaymentSign 使用支付密钥计算 HMAC-SHA256 签名
+func mockPaymentSign(body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(config.GetConfig().Payment.Secret))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hm-dianping-go/config"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testPaymentSecret = "test-payment-secret"
+
+// loadTestPaymentConfig 加载只包含支付配置的测试配置
+func loadTestPaymentConfig(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "application.yaml")
+	data := []byte("payment:\n  mock_enabled: true\n  secret: " + testPaymentSecret + "\n")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("写入测试配置失败: %v", err)
+	}
+	if err := config.LoadConfigFromFile(path); err != nil {
+		t.Fatalf("加载测试配置失败: %v", err)
+	}
+}
+
+// signWith 使用指定密钥计算回调签名
+func signWith(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestMockPaymentParseCallback(t *testing.T) {
+	loadTestPaymentConfig(t)
+
+	body := []byte(`{"paymentNo":"123456","orderId":"42","amount":990,"success":true}`)
+	tampered := []byte(`{"paymentNo":"123456","orderId":"42","amount":1,"success":true}`)
+	invalidJSON := []byte(`not json`)
+
+	tests := []struct {
+		name      string
+		body      []byte
+		signature string
+		wantErr   bool
+	}{
+		{"签名正确", body, signWith(testPaymentSecret, body), false},
+		{"缺少签名", body, "", true},
+		{"签名不是十六进制", body, "not-hex", true},
+		{"使用其他密钥签名", body, signWith("other-secret", body), true},
+		{"请求体被篡改", tampered, signWith(testPaymentSecret, body), true},
+		{"签名被截断", body, signWith(testPaymentSecret, body)[:32], true},
+		{"签名正确但内容无效", invalidJSON, signWith(testPaymentSecret, invalidJSON), true},
+	}
+
+	provider := &mockPaymentProvider{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.signature != "" {
+				header.Set(mockPaymentSignatureHeader, tt.signature)
+			}
+
+			notification, err := provider.ParseCallback(header, tt.body)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("期望校验失败，实际解析成功: %+v", notification)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("期望校验成功，实际失败: %v", err)
+			}
+			if notification.PaymentNo != "123456" || notification.OrderID != 42 || notification.Amount != 990 || !notification.Success {
+				t.Errorf("解析结果不正确: %+v", notification)
+			}
+		})
+	}
+}
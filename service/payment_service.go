@@ -0,0 +1,337 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hm-dianping-go/config"
+	"hm-dianping-go/dao"
+	"hm-dianping-go/models"
+	"hm-dianping-go/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PaymentProvider 支付渠道，接入新的支付渠道只需实现该接口并调用 RegisterPaymentProvider 注册
+type PaymentProvider interface {
+	// Name 渠道名称，与回调地址 /api/pay/callback/:provider 中的 provider 一致
+	Name() string
+	// CreateSession 在支付渠道发起支付，可以补充会话中的支付链接等信息
+	CreateSession(ctx context.Context, session *dao.PaymentSession) error
+	// ParseCallback 校验回调签名并解析支付结果，签名无效时返回错误
+	ParseCallback(header http.Header, body []byte) (*PaymentNotification, error)
+	// Refund 原路退款，返回 nil 表示支付渠道已确认退款成功；同一退款单号重复调用不会重复退款
+	Refund(ctx context.Context, refund *PaymentRefund) error
+}
+
+// PaymentRefund 退款请求
+type PaymentRefund struct {
+	RefundNo  string `json:"refundNo"`
+	PaymentNo string `json:"paymentNo"`
+	OrderID   uint   `json:"orderId,string"`
+	Amount    int64  `json:"amount"`
+}
+
+// PaymentNotification 支付渠道回调的支付结果
+type PaymentNotification struct {
+	PaymentNo string `json:"paymentNo"`
+	OrderID   uint   `json:"orderId,string"`
+	Amount    int64  `json:"amount"`
+	Success   bool   `json:"success"`
+}
+
+// paymentProviders 已注册的支付渠道
+var paymentProviders = map[string]PaymentProvider{}
+
+// RegisterPaymentProvider 注册支付渠道
+func RegisterPaymentProvider(provider PaymentProvider) {
+	paymentProviders[provider.Name()] = provider
+}
+
+// InitPaymentProviders 注册配置中启用的支付渠道
+// 模拟支付会自动回调支付成功，只能在开发和测试环境通过 payment.mock_enabled 显式启用
+func InitPaymentProviders() {
+	cfg := config.GetConfig().Payment
+	if cfg.MockEnabled {
+		RegisterPaymentProvider(&mockPaymentProvider{})
+		log.Println("警告: 已启用模拟支付渠道，请勿在生产环境使用")
+	}
+	if _, ok := paymentProviders[cfg.Provider]; !ok {
+		log.Printf("警告: 支付渠道 %s 未注册，发起支付将失败", cfg.Provider)
+	}
+}
+
+// PayVoucherOrder 为未支付的订单创建支付会话，支付结果由支付渠道异步回调通知
+func PayVoucherOrder(ctx context.Context, userId, orderId uint) *utils.Result {
+	order, err := dao.GetVoucherOrderByID(ctx, dao.DB, orderId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResult("订单不存在")
+		}
+		log.Printf("查询订单失败: orderId=%d, error=%v", orderId, err)
+		return utils.ErrorResult("系统错误")
+	}
+	if order.UserID != userId {
+		return utils.ErrorResult("订单不存在")
+	}
+	if order.Status != models.OrderStatusUnpaid {
+		return utils.ErrorResult("当前订单状态不允许该操作")
+	}
+
+	// 订单已有未过期的支付会话时直接返回，避免重复发起支付
+	session, err := dao.GetOrderPaymentSession(ctx, dao.Redis, orderId)
+	if err != nil {
+		log.Printf("查询支付会话失败: orderId=%d, error=%v", orderId, err)
+		return utils.ErrorResult("系统错误")
+	}
+	if session != nil {
+		return utils.SuccessResultWithData(session)
+	}
+
+	cfg := config.GetConfig().Payment
+	provider, ok := paymentProviders[cfg.Provider]
+	if !ok {
+		log.Printf("支付渠道未注册: %s", cfg.Provider)
+		return utils.ErrorResult("支付渠道不可用")
+	}
+
+	voucher, err := dao.GetVoucherByID(ctx, dao.DB, order.VoucherID)
+	if err != nil {
+		log.Printf("查询优惠券失败: voucherId=%d, error=%v", order.VoucherID, err)
+		return utils.ErrorResult("系统错误")
+	}
+
+	// 秒杀订单会被超时取消，支付会话不能晚于订单的支付截止时间，否则订单取消后仍可能支付成功
+	deadline := time.Now().Add(time.Duration(config.GetConfig().Seckill.PayTimeout) * time.Second)
+	if order.VoucherType == 2 {
+		deadline = orderPayDeadline(order)
+	}
+	ttl := time.Until(deadline)
+	if ttl <= 0 {
+		return utils.ErrorResult("订单已超时，请重新下单")
+	}
+	session = &dao.PaymentSession{
+		PaymentNo: strconv.FormatUint(uint64(orderId), 10) + utils.GenerateDigitString(6),
+		Provider:  provider.Name(),
+		OrderID:   orderId,
+		UserID:    userId,
+		Amount:    voucher.PayValue,
+		ExpireAt:  deadline,
+	}
+	if err := provider.CreateSession(ctx, session); err != nil {
+		log.Printf("发起支付失败: orderId=%d, provider=%s, error=%v", orderId, provider.Name(), err)
+		return utils.ErrorResult("发起支付失败")
+	}
+	if err := dao.SetPaymentSession(ctx, dao.Redis, session, ttl); err != nil {
+		log.Printf("保存支付会话失败: orderId=%d, error=%v", orderId, err)
+		return utils.ErrorResult("系统错误")
+	}
+
+	return utils.SuccessResultWithData(session)
+}
+
+// HandlePaymentCallback 处理支付渠道的支付结果回调
+// 支付渠道可能重复通知，已处理过的通知直接返回成功
+func HandlePaymentCallback(ctx context.Context, providerName string, header http.Header, body []byte) *utils.Result {
+	provider, ok := paymentProviders[providerName]
+	if !ok {
+		return utils.ErrorResult("不支持的支付渠道")
+	}
+
+	notification, err := provider.ParseCallback(header, body)
+	if err != nil {
+		log.Printf("支付回调校验失败: provider=%s, error=%v", providerName, err)
+		return utils.ErrorResult("签名校验失败")
+	}
+
+	notified, err := dao.IsPaymentNotified(ctx, dao.Redis, notification.PaymentNo)
+	if err != nil {
+		log.Printf("查询支付通知记录失败: paymentNo=%s, error=%v", notification.PaymentNo, err)
+		return utils.ErrorResult("系统错误")
+	}
+	if notified {
+		return utils.SuccessResult("ok")
+	}
+
+	session, err := dao.GetPaymentSession(ctx, dao.Redis, notification.PaymentNo)
+	if err != nil {
+		log.Printf("查询支付会话失败: paymentNo=%s, error=%v", notification.PaymentNo, err)
+		return utils.ErrorResult("系统错误")
+	}
+	// 会话在支付截止时间后仍会保留一段时间，延迟到达的回调可以正常校验，订单已取消时由 confirmOrderPaid 原路退款
+	if session == nil {
+		log.Printf("支付会话不存在或已超过保留期: paymentNo=%s, orderId=%d", notification.PaymentNo, notification.OrderID)
+		return utils.ErrorResult("支付会话不存在")
+	}
+	if session.Provider != providerName || session.OrderID != notification.OrderID || session.Amount != notification.Amount {
+		log.Printf("支付回调与支付会话不一致: paymentNo=%s, session=%+v, notification=%+v", notification.PaymentNo, session, notification)
+		return utils.ErrorResult("支付信息不一致")
+	}
+
+	if notification.Success {
+		if err := confirmOrderPaid(ctx, session); err != nil {
+			log.Printf("处理支付成功通知失败: paymentNo=%s, orderId=%d, error=%v", notification.PaymentNo, notification.OrderID, err)
+			return utils.ErrorResult("处理失败")
+		}
+	} else {
+		log.Printf("支付未成功: paymentNo=%s, orderId=%d", notification.PaymentNo, notification.OrderID)
+	}
+
+	if err := dao.MarkPaymentNotified(ctx, dao.Redis, notification.PaymentNo); err != nil {
+		log.Printf("记录支付通知失败: paymentNo=%s, error=%v", notification.PaymentNo, err)
+	}
+	return utils.SuccessResult("ok")
+}
+
+// confirmOrderPaid 将订单更新为已支付并记录支付流水，订单已是已支付及之后的状态时视为成功，已取消的订单原路退款
+func confirmOrderPaid(ctx context.Context, session *dao.PaymentSession) error {
+	order, err := dao.GetVoucherOrderByID(ctx, dao.DB, session.OrderID)
+	if err != nil {
+		return err
+	}
+
+	switch order.Status {
+	case models.OrderStatusUnpaid:
+		// 与超时取消并发时由状态CAS保证只有一方成功，失败时返回错误让支付渠道重试
+		return transitVoucherOrder(ctx, order, models.OrderStatusPaid, map[string]interface{}{
+			"payment_no":   session.PaymentNo,
+			"pay_provider": session.Provider,
+			"pay_amount":   session.Amount,
+		})
+	case models.OrderStatusCancelled:
+		// 订单超时取消后才收到支付成功通知，原路退款；退款失败时返回错误让支付渠道重试，并由退款重试任务兜底
+		return refundCancelledOrderPayment(ctx, order, session)
+	}
+	return nil
+}
+
+// refundCancelledOrderPayment 记录已取消订单的支付信息并原路退款
+func refundCancelledOrderPayment(ctx context.Context, order *models.VoucherOrder, session *dao.PaymentSession) error {
+	if order.PaymentNo == nil {
+		if err := dao.RecordCancelledOrderPayment(ctx, dao.DB, order.ID, session.PaymentNo, session.Provider, session.Amount); err != nil {
+			return fmt.Errorf("记录已取消订单的支付信息失败: %v", err)
+		}
+		order.PaymentNo = &session.PaymentNo
+		order.PayProvider = session.Provider
+		order.PayAmount = session.Amount
+		order.RefundStatus = models.RefundStatusPending
+	} else if *order.PaymentNo != session.PaymentNo {
+		log.Printf("已取消订单收到另一笔支付成功通知，需要人工退款: orderId=%d, paymentNo=%s", order.ID, session.PaymentNo)
+		return nil
+	}
+
+	log.Printf("订单已取消但收到支付成功通知，原路退款: orderId=%d, paymentNo=%s", order.ID, session.PaymentNo)
+	return retryCancelledOrderRefund(ctx, order)
+}
+
+// retryCancelledOrderRefund 对待退款的已取消订单发起退款，退款单号固定，重复调用不会重复退钱
+func retryCancelledOrderRefund(ctx context.Context, order *models.VoucherOrder) error {
+	if order.RefundStatus != models.RefundStatusPending {
+		return nil
+	}
+	if err := refundOrderPayment(ctx, order); err != nil {
+		return fmt.Errorf("支付渠道退款失败: %v", err)
+	}
+
+	now := time.Now()
+	if err := dao.MarkCancelledOrderRefunded(ctx, dao.DB, order.ID, now); err != nil {
+		return fmt.Errorf("更新退款状态失败: %v", err)
+	}
+	order.RefundStatus = models.RefundStatusDone
+	order.RefundTime = &now
+	log.Printf("已取消订单退款完成: orderId=%d, amount=%d", order.ID, order.PayAmount)
+	return nil
+}
+
+// 已取消订单退款重试任务配置
+const (
+	cancelledRefundRetryInterval = time.Minute // 扫描间隔
+	cancelledRefundRetryBatch    = 100         // 单次查询的订单数
+	cancelledRefundRetryLockKey  = "lock:order:cancelled_refund_retry"
+)
+
+// 已取消订单退款重试任务状态
+var (
+	cancelledRefundStopChan = make(chan struct{}) // 停止信号
+	cancelledRefundWg       sync.WaitGroup
+)
+
+// StartCancelledOrderRefundRetrier 启动已取消订单退款重试任务，定期对退款失败的订单重新发起退款
+// 需要在注册支付渠道之后启动
+func StartCancelledOrderRefundRetrier() {
+	cancelledRefundWg.Add(1)
+	go func() {
+		defer cancelledRefundWg.Done()
+
+		ticker := time.NewTicker(cancelledRefundRetryInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-cancelledRefundStopChan:
+				log.Println("已取消订单退款重试任务收到停止信号，正在退出")
+				return
+			case <-ticker.C:
+				// 锁在一个扫描间隔后自动过期且不主动释放，多实例部署时每个间隔只有一个实例执行
+				ctx := context.Background()
+				if ok, _ := utils.TryLockWithTTL(ctx, dao.Redis, cancelledRefundRetryLockKey, cancelledRefundRetryInterval); !ok {
+					continue
+				}
+				if err := retryCancelledOrderRefunds(ctx); err != nil {
+					log.Printf("重试已取消订单退款失败: %v", err)
+				}
+			}
+		}
+	}()
+
+	log.Printf("已取消订单退款重试任务已启动，扫描间隔: %v", cancelledRefundRetryInterval)
+}
+
+// StopCancelledOrderRefundRetrier 停止已取消订单退款重试任务
+func StopCancelledOrderRefundRetrier() {
+	close(cancelledRefundStopChan)
+	cancelledRefundWg.Wait()
+}
+
+// retryCancelledOrderRefunds 对所有待退款的已取消订单重新发起退款，单个订单失败不影响其他订单
+func retryCancelledOrderRefunds(ctx context.Context) error {
+	var afterID uint
+	for {
+		orders, err := dao.GetPendingRefundOrders(ctx, dao.DB, afterID, cancelledRefundRetryBatch)
+		if err != nil {
+			return err
+		}
+		for i := range orders {
+			if err := retryCancelledOrderRefund(ctx, &orders[i]); err != nil {
+				log.Printf("已取消订单退款失败，稍后重试: orderId=%d, error=%v", orders[i].ID, err)
+			}
+		}
+
+		if len(orders) < cancelledRefundRetryBatch {
+			return nil
+		}
+		afterID = orders[len(orders)-1].ID
+	}
+}
+
+// refundOrderPayment 通过订单的原支付渠道退款，退款单号由支付流水号生成，重复退款不会重复退钱
+func refundOrderPayment(ctx context.Context, order *models.VoucherOrder) error {
+	if order.PaymentNo == nil {
+		return errors.New("订单没有支付记录")
+	}
+	provider, ok := paymentProviders[order.PayProvider]
+	if !ok {
+		return fmt.Errorf("支付渠道未注册: %s", order.PayProvider)
+	}
+	return provider.Refund(ctx, &PaymentRefund{
+		RefundNo:  "R" + *order.PaymentNo,
+		PaymentNo: *order.PaymentNo,
+		OrderID:   order.ID,
+		Amount:    order.PayAmount,
+	})
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"hm-dianping-go/config"
+	"hm-dianping-go/dao"
+	"hm-dianping-go/script"
+	"hm-dianping-go/utils"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// seckillQueueAdmitLockKey 放行任务锁，多个实例同一放行间隔内只有一个实例放行
+const seckillQueueAdmitLockKey = "lock:seckill:queue:admit"
+
+// 排队状态
+const (
+	SeckillTicketNone     = "none"     // 未排队
+	SeckillTicketWaiting  = "waiting"  // 排队中
+	SeckillTicketAdmitted = "admitted" // 已放行，持有购买许可
+)
+
+// SeckillTicket 用户的排队状态
+type SeckillTicket struct {
+	VoucherID      uint   `json:"voucherId"`
+	Status         string `json:"status"`
+	Position       int64  `json:"position,omitempty"`       // 排队位置，从1开始
+	PermitExpireIn int64  `json:"permitExpireIn,omitempty"` // 购买许可剩余有效期（秒）
+}
+
+// 排队放行任务状态
+var (
+	queueAdmitStopChan = make(chan struct{}) // 停止信号
+	queueAdmitWg       sync.WaitGroup
+)
+
+// IssueSeckillTicket 为用户领取排队秒杀券的排队号，秒杀开始前即可排队，已排队或已放行时返回当前状态
+func IssueSeckillTicket(ctx context.Context, userId, voucherId uint) *utils.Result {
+	meta, err := dao.GetSeckillVoucherMetaCache(ctx, dao.Redis, voucherId)
+	if err != nil {
+		log.Printf("查询秒杀券元信息失败: voucherId=%d, error=%v", voucherId, err)
+		return utils.ErrorResult("系统错误")
+	}
+	if len(meta) == 0 {
+		return utils.ErrorResult(seckillFailMessage(seckillNotInitialized))
+	}
+	if meta["queued"] != "1" {
+		return utils.ErrorResult("该秒杀券无需排队")
+	}
+	if meta["status"] == "2" {
+		return utils.ErrorResult(seckillFailMessage(seckillOffline))
+	}
+	if end, err := strconv.ParseInt(meta["end"], 10, 64); err == nil && time.Now().UnixMilli() > end {
+		return utils.ErrorResult(seckillFailMessage(seckillEnded))
+	}
+
+	ticket, err := getSeckillTicket(ctx, userId, voucherId)
+	if err != nil {
+		log.Printf("查询排队状态失败: userId=%d, voucherId=%d, error=%v", userId, voucherId, err)
+		return utils.ErrorResult("系统错误")
+	}
+	if ticket.Status != SeckillTicketNone {
+		return utils.SuccessResultWithData(ticket)
+	}
+
+	if err := dao.AddSeckillQueueTicket(ctx, dao.Redis, voucherId, userId); err != nil {
+		log.Printf("领取排队号失败: userId=%d, voucherId=%d, error=%v", userId, voucherId, err)
+		return utils.ErrorResult("系统错误")
+	}
+
+	ticket, err = getSeckillTicket(ctx, userId, voucherId)
+	if err != nil {
+		log.Printf("查询排队状态失败: userId=%d, voucherId=%d, error=%v", userId, voucherId, err)
+		return utils.ErrorResult("系统错误")
+	}
+	return utils.SuccessResultWithData(ticket)
+}
+
+// GetSeckillTicket 查询用户的排队状态，客户端轮询到已放行后即可发起秒杀
+func GetSeckillTicket(ctx context.Context, userId, voucherId uint) *utils.Result {
+	ticket, err := getSeckillTicket(ctx, userId, voucherId)
+	if err != nil {
+		log.Printf("查询排队状态失败: userId=%d, voucherId=%d, error=%v", userId, voucherId, err)
+		return utils.ErrorResult("系统错误")
+	}
+	return utils.SuccessResultWithData(ticket)
+}
+
+// getSeckillTicket 查询用户的购买许可和排队位置
+func getSeckillTicket(ctx context.Context, userId, voucherId uint) (*SeckillTicket, error) {
+	ticket := &SeckillTicket{VoucherID: voucherId, Status: SeckillTicketNone}
+
+	ttl, err := dao.GetSeckillPermitTTL(ctx, dao.Redis, voucherId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		ticket.Status = SeckillTicketAdmitted
+		ticket.PermitExpireIn = int64((ttl + time.Second - 1) / time.Second)
+		return ticket, nil
+	}
+
+	rank, err := dao.GetSeckillQueueRank(ctx, dao.Redis, voucherId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if rank >= 0 {
+		ticket.Status = SeckillTicketWaiting
+		ticket.Position = rank + 1
+	}
+	return ticket, nil
+}
+
+// StartSeckillQueueAdmitter 启动排队放行任务，秒杀开始后按配置的批次和间隔放行排队用户
+func StartSeckillQueueAdmitter() {
+	cfg := config.GetConfig().Seckill.Queue
+	interval := time.Duration(cfg.AdmitInterval) * time.Second
+
+	queueAdmitWg.Add(1)
+	go func() {
+		defer queueAdmitWg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-queueAdmitStopChan:
+				log.Println("排队放行任务收到停止信号，正在退出")
+				return
+			case <-ticker.C:
+				// 锁在一个放行间隔后自动过期且不主动释放，保证多实例部署时放行速率不会叠加
+				ctx := context.Background()
+				if ok, _ := utils.TryLockWithTTL(ctx, dao.Redis, seckillQueueAdmitLockKey, interval); !ok {
+					continue
+				}
+				if err := admitSeckillQueues(ctx, cfg); err != nil {
+					log.Printf("排队放行失败: %v", err)
+				}
+			}
+		}
+	}()
+
+	log.Printf("排队放行任务已启动，每 %ds 每张秒杀券放行 %d 人，购买许可有效期: %ds",
+		cfg.AdmitInterval, cfg.AdmitBatch, cfg.PermitTTL)
+}
+
+// StopSeckillQueueAdmitter 停止排队放行任务
+func StopSeckillQueueAdmitter() {
+	close(queueAdmitStopChan)
+	queueAdmitWg.Wait()
+}
+
+// admitSeckillQueues 对每张存在排队用户的秒杀券放行一批用户
+func admitSeckillQueues(ctx context.Context, cfg config.QueueConfig) error {
+	voucherIds, err := dao.GetSeckillQueueVouchers(ctx, dao.Redis)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UnixMilli()
+	for _, voucherId := range voucherIds {
+		meta, err := dao.GetSeckillVoucherMetaCache(ctx, dao.Redis, voucherId)
+		if err != nil {
+			log.Printf("查询秒杀券元信息失败: voucherId=%d, error=%v", voucherId, err)
+			continue
+		}
+		begin, errBegin := strconv.ParseInt(meta["begin"], 10, 64)
+		end, errEnd := strconv.ParseInt(meta["end"], 10, 64)
+		// 秒杀券已删除或秒杀已结束，剩余排队用户不会再被放行
+		if errBegin != nil || errEnd != nil || now > end {
+			if err := dao.DelSeckillQueue(ctx, dao.Redis, voucherId); err != nil {
+				log.Printf("清理排队队列失败: voucherId=%d, error=%v", voucherId, err)
+			}
+			continue
+		}
+		if now < begin {
+			continue
+		}
+
+		admitted, err := script.SeckillQueueAdmit.Run(ctx, dao.Redis, []string{},
+			strconv.Itoa(int(voucherId)), cfg.AdmitBatch, cfg.PermitTTL*1000).Int()
+		if err != nil {
+			log.Printf("执行排队放行脚本失败: voucherId=%d, error=%v", voucherId, err)
+			continue
+		}
+		if admitted > 0 {
+			log.Printf("排队放行: voucherId=%d, 放行人数=%d", voucherId, admitted)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"hm-dianping-go/config"
+	"hm-dianping-go/dao"
+	"hm-dianping-go/models"
+	"hm-dianping-go/script"
+	"hm-dianping-go/utils"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 对账修复脚本返回值
+const (
+	reconcileRepairSuccess     = 0 // 修复成功
+	reconcileRepairPending     = 1 // 存在已投递但未确认的订单消息
+	reconcileRepairUndelivered = 2 // 存在尚未投递给消费者组的订单消息
+	reconcileRepairInSale      = 3 // 秒杀进行中
+)
+
+// SeckillReconcileItem 单个秒杀券的对账结果
+type SeckillReconcileItem struct {
+	VoucherID       uint   `json:"voucherId"`
+	DBStock         int    `json:"dbStock"`
+	DBOrderCount    int64  `json:"dbOrderCount"`
+	RedisStock      *int   `json:"redisStock"` // nil 表示库存缓存缺失
+	RedisOrderCount int64  `json:"redisOrderCount"`
+	Repaired        bool   `json:"repaired"`
+	Message         string `json:"message,omitempty"`
+}
+
+// SeckillReconcileReport 一次对账的汇总结果，只记录存在差异的秒杀券
+type SeckillReconcileReport struct {
+	StartedAt  time.Time              `json:"startedAt"`
+	FinishedAt time.Time              `json:"finishedAt"`
+	Repair     bool                   `json:"repair"`
+	Total      int                    `json:"total"`
+	Drifted    int                    `json:"drifted"`
+	Items      []SeckillReconcileItem `json:"items"`
+}
+
+// 对账相关状态
+var (
+	lastReconcileReport *SeckillReconcileReport // 最近一次对账结果
+	reconcileMutex      sync.Mutex              // 保证同一时间只有一个对账任务在执行
+	reconcileStopChan   = make(chan struct{})   // 后台对账停止信号
+	reconcileWg         sync.WaitGroup
+)
+
+// ReconcileSeckill 对比每张秒杀券在Redis中的库存/用户已购总数与MySQL中的库存/订单数
+// repair 为 true 时使用MySQL数据修复Redis
+// 注意：订单消息尚未落库时Redis会暂时领先于MySQL，此时的差异属于正常现象，
+// 因此存在未投递或未确认的订单消息时不会执行修复，秒杀进行中的秒杀券也不会修复
+func ReconcileSeckill(ctx context.Context, repair bool) (*SeckillReconcileReport, error) {
+	reconcileMutex.Lock()
+	defer reconcileMutex.Unlock()
+
+	report := &SeckillReconcileReport{
+		StartedAt: time.Now(),
+		Repair:    repair,
+		Items:     []SeckillReconcileItem{},
+	}
+
+	vouchers, err := dao.GetAllSeckillVouchers(ctx, dao.DB)
+	if err != nil {
+		return nil, fmt.Errorf("查询秒杀券失败: %v", err)
+	}
+	report.Total = len(vouchers)
+
+	// 存在未落库的订单消息时，Redis数据领先于MySQL，修复会导致超卖
+	// 这里只是提前拒绝，修复脚本执行时会再次检查
+	if repair {
+		if err := checkSeckillOrdersDrained(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, voucher := range vouchers {
+		item := SeckillReconcileItem{
+			VoucherID: voucher.VoucherID,
+			DBStock:   voucher.Stock,
+		}
+
+		if item.DBOrderCount, err = dao.CountSeckillOrdersByVoucher(ctx, dao.DB, voucher.VoucherID); err != nil {
+			return nil, fmt.Errorf("统计订单数失败: voucherId=%d, error=%v", voucher.VoucherID, err)
+		}
+		if item.RedisStock, err = dao.GetSeckillVoucherStockCache(ctx, dao.Redis, voucher.VoucherID); err != nil {
+			return nil, fmt.Errorf("查询库存缓存失败: voucherId=%d, error=%v", voucher.VoucherID, err)
+		}
+		if item.RedisOrderCount, err = dao.SumSeckillVoucherPurchaseCache(ctx, dao.Redis, voucher.VoucherID); err != nil {
+			return nil, fmt.Errorf("统计用户已购数量失败: voucherId=%d, error=%v", voucher.VoucherID, err)
+		}
+
+		if item.RedisStock != nil && *item.RedisStock == item.DBStock && item.RedisOrderCount == item.DBOrderCount {
+			continue
+		}
+
+		report.Drifted++
+		if repair {
+			if now := time.Now(); !now.Before(voucher.BeginTime) && !now.After(voucher.EndTime) {
+				item.Message = "秒杀进行中，不执行修复"
+			} else if err := repairSeckillCache(ctx, &voucher); err != nil {
+				item.Message = err.Error()
+			} else {
+				item.Repaired = true
+			}
+		}
+		report.Items = append(report.Items, item)
+	}
+
+	report.FinishedAt = time.Now()
+	lastReconcileReport = report
+	return report, nil
+}
+
+// checkSeckillOrdersDrained 检查订单Stream中的消息是否都已被消费者组确认
+// 只检查pending不够：已写入Stream但尚未投递给消费者组的消息同样没有落库
+func checkSeckillOrdersDrained(ctx context.Context) error {
+	exists, err := checkStreamExists(ctx, streamKey)
+	if err != nil {
+		return fmt.Errorf("检查订单Stream失败: %v", err)
+	}
+	if !exists {
+		return nil
+	}
+
+	groups, err := dao.Redis.XInfoGroups(ctx, streamKey).Result()
+	if err != nil {
+		return fmt.Errorf("查询消费者组失败: %v", err)
+	}
+
+	lastDeliveredID := "-"
+	for _, group := range groups {
+		if group.Name != groupName {
+			continue
+		}
+		if group.Pending > 0 {
+			return fmt.Errorf("存在 %d 条未处理的订单消息，请稍后再修复", group.Pending)
+		}
+		lastDeliveredID = "(" + group.LastDeliveredID
+	}
+
+	undelivered, err := dao.Redis.XRangeN(ctx, streamKey, lastDeliveredID, "+", 1).Result()
+	if err != nil {
+		return fmt.Errorf("查询未投递的订单消息失败: %v", err)
+	}
+	if len(undelivered) > 0 {
+		return fmt.Errorf("存在尚未投递的订单消息，请稍后再修复")
+	}
+	return nil
+}
+
+// repairSeckillCache 使用MySQL中的库存与订单重建Redis秒杀数据
+// 检查与重建在同一个脚本中原子执行，避免覆盖检查之后新产生的预扣减
+func repairSeckillCache(ctx context.Context, voucher *models.SeckillVoucher) error {
+	counts, err := dao.GetSeckillOrderCountsByUser(ctx, dao.DB, voucher.VoucherID)
+	if err != nil {
+		return fmt.Errorf("查询用户已购数量失败: %v", err)
+	}
+
+	limit := voucher.LimitPerUser
+	if limit <= 0 {
+		limit = 1
+	}
+	queued := 0
+	if voucher.Queued {
+		queued = 1
+	}
+	args := []interface{}{
+		strconv.Itoa(int(voucher.VoucherID)), streamKey, groupName, voucher.Stock,
+		voucher.BeginTime.UnixMilli(), voucher.EndTime.UnixMilli(), limit, queued,
+	}
+	for userID, count := range counts {
+		args = append(args, userID, count)
+	}
+
+	r, err := script.SeckillReconcileRepair.Run(ctx, dao.Redis, []string{}, args...).Int()
+	if err != nil {
+		return fmt.Errorf("执行修复脚本失败: %v", err)
+	}
+	switch r {
+	case reconcileRepairSuccess:
+	case reconcileRepairPending:
+		return fmt.Errorf("存在未处理的订单消息，未修复")
+	case reconcileRepairUndelivered:
+		return fmt.Errorf("存在尚未投递的订单消息，未修复")
+	case reconcileRepairInSale:
+		return fmt.Errorf("秒杀进行中，不执行修复")
+	default:
+		return fmt.Errorf("修复脚本返回未知结果: %d", r)
+	}
+
+	notifySeckillStockReplenished(ctx, voucher.VoucherID)
+	log.Printf("已使用MySQL数据修复秒杀缓存: voucherId=%d, stock=%d, users=%d", voucher.VoucherID, voucher.Stock, len(counts))
+	return nil
+}
+
+// StartSeckillReconciler 启动后台对账任务
+func StartSeckillReconciler() {
+	cfg := config.GetConfig().Seckill
+	if cfg.ReconcileInterval < 0 {
+		log.Println("后台秒杀对账任务未启用")
+		return
+	}
+
+	reconcileWg.Add(1)
+	go func() {
+		defer reconcileWg.Done()
+
+		ticker := time.NewTicker(time.Duration(cfg.ReconcileInterval) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-reconcileStopChan:
+				log.Println("后台秒杀对账任务收到停止信号，正在退出")
+				return
+			case <-ticker.C:
+				report, err := ReconcileSeckill(context.Background(), cfg.ReconcileRepair)
+				if err != nil {
+					log.Printf("秒杀对账失败: %v", err)
+					continue
+				}
+				if report.Drifted > 0 {
+					log.Printf("秒杀对账发现 %d/%d 张秒杀券数据不一致: %+v", report.Drifted, report.Total, report.Items)
+				}
+			}
+		}
+	}()
+
+	log.Printf("后台秒杀对账任务已启动，间隔: %ds, 自动修复: %v", cfg.ReconcileInterval, cfg.ReconcileRepair)
+}
+
+// StopSeckillReconciler 停止后台对账任务
+func StopSeckillReconciler() {
+	close(reconcileStopChan)
+	reconcileWg.Wait()
+}
+
+// GetLastSeckillReconcileReport 获取最近一次对账结果
+func GetLastSeckillReconcileReport() *utils.Result {
+	reconcileMutex.Lock()
+	defer reconcileMutex.Unlock()
+
+	if lastReconcileReport == nil {
+		return utils.ErrorResult("暂无对账结果")
+	}
+	return utils.SuccessResultWithData(lastReconcileReport)
+}
+
+// RunSeckillReconcile 立即执行一次对账
+func RunSeckillReconcile(ctx context.Context, repair bool) *utils.Result {
+	report, err := ReconcileSeckill(ctx, repair)
+	if err != nil {
+		log.Printf("秒杀对账失败: %v", err)
+		return utils.ErrorResult("对账失败: " + err.Error())
+	}
+	return utils.SuccessResultWithData(report)
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"hm-dianping-go/dao"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// soldOutMarkerTTL 本地售罄标记的有效期，作为丢失回补通知时的兜底
+const soldOutMarkerTTL = time.Minute
+
+// 本地售罄标记相关状态
+var (
+	seckillSoldOut      sync.Map      // 已售罄的秒杀券，voucherId -> 标记过期时间
+	soldOutPubSub       *redis.PubSub // 库存回补通知订阅，关闭后订阅协程退出
+	soldOutSubscriberWg sync.WaitGroup
+)
+
+// markSeckillSoldOut 标记秒杀券已售罄，之后的秒杀请求直接在本地拒绝
+func markSeckillSoldOut(voucherId uint) {
+	seckillSoldOut.Store(voucherId, time.Now().Add(soldOutMarkerTTL))
+}
+
+// isSeckillSoldOut 判断秒杀券是否已被本地标记为售罄
+func isSeckillSoldOut(voucherId uint) bool {
+	v, ok := seckillSoldOut.Load(voucherId)
+	if !ok {
+		return false
+	}
+	if time.Now().After(v.(time.Time)) {
+		seckillSoldOut.Delete(voucherId)
+		return false
+	}
+	return true
+}
+
+// clearAllSeckillSoldOut 清除所有本地售罄标记
+func clearAllSeckillSoldOut() {
+	seckillSoldOut.Range(func(key, _ interface{}) bool {
+		seckillSoldOut.Delete(key)
+		return true
+	})
+}
+
+// notifySeckillStockReplenished 秒杀券库存回补后清除本实例的售罄标记，并通知其他实例清除
+func notifySeckillStockReplenished(ctx context.Context, voucherId uint) {
+	seckillSoldOut.Delete(voucherId)
+	if err := dao.PublishSeckillStockReplenished(ctx, dao.Redis, voucherId); err != nil {
+		// 其他实例的售罄标记会在有效期结束后自动失效
+		log.Printf("发布库存回补通知失败: voucherId=%d, error=%v", voucherId, err)
+	}
+}
+
+// StartSeckillSoldOutSubscriber 订阅库存回补通知，清除本地售罄标记
+func StartSeckillSoldOutSubscriber() {
+	ctx := context.Background()
+	soldOutPubSub = dao.Redis.Subscribe(ctx, dao.SeckillStockReplenishedChannel)
+
+	soldOutSubscriberWg.Add(1)
+	go func() {
+		defer soldOutSubscriberWg.Done()
+
+		ch := soldOutPubSub.ChannelWithSubscriptions(ctx, 100)
+		for msg := range ch {
+			switch m := msg.(type) {
+			case *redis.Subscription:
+				// 连接断开期间的通知会丢失，(重新)订阅成功后清除所有售罄标记
+				if m.Kind == "subscribe" {
+					clearAllSeckillSoldOut()
+				}
+			case *redis.Message:
+				voucherId, err := strconv.ParseUint(m.Payload, 10, 32)
+				if err != nil {
+					log.Printf("库存回补通知内容无效: %s", m.Payload)
+					continue
+				}
+				seckillSoldOut.Delete(uint(voucherId))
+			}
+		}
+		log.Println("库存回补通知订阅已退出")
+	}()
+
+	log.Printf("库存回补通知订阅已启动，频道: %s", dao.SeckillStockReplenishedChannel)
+}
+
+// StopSeckillSoldOutSubscriber 停止库存回补通知订阅
+func StopSeckillSoldOutSubscriber() {
+	if soldOutPubSub == nil {
+		return
+	}
+	if err := soldOutPubSub.Close(); err != nil {
+		log.Printf("关闭库存回补通知订阅失败: %v", err)
+	}
+	soldOutSubscriberWg.Wait()
+}
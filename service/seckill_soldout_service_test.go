@@ -0,0 +1,62 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsSeckillSoldOut(t *testing.T) {
+	tests := []struct {
+		name     string
+		expireAt *time.Time // nil 表示未标记售罄
+		want     bool
+	}{
+		{"未标记售罄", nil, false},
+		{"标记仍在有效期内", timePtr(time.Now().Add(time.Minute)), true},
+		{"标记已过期", timePtr(time.Now().Add(-time.Millisecond)), false},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			voucherId := uint(1000 + i)
+			seckillSoldOut.Delete(voucherId)
+			if tt.expireAt != nil {
+				seckillSoldOut.Store(voucherId, *tt.expireAt)
+			}
+			defer seckillSoldOut.Delete(voucherId)
+
+			if got := isSeckillSoldOut(voucherId); got != tt.want {
+				t.Errorf("isSeckillSoldOut() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpiredSoldOutMarkerIsRemoved(t *testing.T) {
+	const voucherId = 2000
+	seckillSoldOut.Store(uint(voucherId), time.Now().Add(-time.Second))
+	defer seckillSoldOut.Delete(uint(voucherId))
+
+	isSeckillSoldOut(voucherId)
+	if _, ok := seckillSoldOut.Load(uint(voucherId)); ok {
+		t.Error("过期的售罄标记应在检查时被删除")
+	}
+}
+
+func TestMarkSeckillSoldOut(t *testing.T) {
+	const voucherId = 3000
+	defer seckillSoldOut.Delete(uint(voucherId))
+
+	markSeckillSoldOut(voucherId)
+	if !isSeckillSoldOut(voucherId) {
+		t.Fatal("标记售罄后应在本地拒绝")
+	}
+	v, _ := seckillSoldOut.Load(uint(voucherId))
+	if ttl := time.Until(v.(time.Time)); ttl <= 0 || ttl > soldOutMarkerTTL {
+		t.Errorf("售罄标记有效期 = %v, want (0, %v]", ttl, soldOutMarkerTTL)
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
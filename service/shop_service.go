@@ -2,78 +2,214 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hm-dianping-go/config"
 	"hm-dianping-go/dao"
 	"hm-dianping-go/models"
 	"hm-dianping-go/utils"
 	"log"
-	"time"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
 )
 
 // GetShopById 根据ID获取商铺
+// 布隆过滤器和空值缓存防止缓存穿透；热点商铺使用逻辑过期、其他商铺使用互斥锁防止缓存击穿
 func GetShopById(ctx context.Context, id uint) *utils.Result {
-	// 1. 布隆过滤器检查，防止缓存击穿
-	flag, err := utils.CheckIDExistsWithRedis(ctx, dao.Redis, "shop", id)
-	if err != nil {
-		log.Fatalf("检查布隆过滤器失败: %v", err)
+	var shop *models.Shop
+	var err error
+	if config.GetConfig().Cache.IsHotShop(id) {
+		shop, err = hotShopCache().QueryWithLogicalExpire(ctx, id, loadShop)
+	} else {
+		shop, err = shopCache().QueryWithMutex(ctx, id, loadShop)
 	}
-	if !flag {
-		// 布隆过滤器判断商铺不存在，直接返回
-		return utils.ErrorResult("商铺不存在")
+	if err != nil {
+		if errors.Is(err, utils.ErrCacheNotFound) {
+			return utils.ErrorResult("商铺不存在")
+		}
+		if errors.Is(err, utils.ErrCacheBusy) {
+			return utils.ErrorResult(err.Error())
+		}
+		return utils.ErrorResult("查询失败: " + err.Error())
 	}
+	return utils.SuccessResultWithData(shop)
+}
 
-	// 2. 先从缓存查询
-	shop, err := dao.GetShopCacheById(ctx, dao.Redis, id)
-	if err == nil && shop != nil {
-		// 缓存命中，直接返回
-		return utils.SuccessResultWithData(shop)
+// WarmUpHotShops 将配置的热点商铺加载到逻辑过期缓存，返回成功加载的数量
+func WarmUpHotShops(ctx context.Context) (int, error) {
+	cache := hotShopCache()
+	warmed := 0
+	for _, id := range config.GetConfig().Cache.HotShopIDs {
+		shop, err := dao.GetShopById(ctx, dao.DB, id)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("热点商铺不存在，跳过: shopId=%d", id)
+				continue
+			}
+			return warmed, fmt.Errorf("查询商铺失败: shopId=%d, error=%v", id, err)
+		}
+		if err := cache.SetWithLogicalExpire(ctx, id, shop); err != nil {
+			return warmed, fmt.Errorf("写入热点商铺缓存失败: shopId=%d, error=%v", id, err)
+		}
+		warmed++
 	}
 
-	// 3. 缓存未命中，使用互斥锁防止缓存击穿
-	lockKey := fmt.Sprintf("lock:shop:%d", id)
+	log.Printf("热点商铺缓存预热完成: 配置=%d, 加载=%d", len(config.GetConfig().Cache.HotShopIDs), warmed)
+	return warmed, nil
+}
 
-	// 尝试获取锁
-	if !utils.TryLock(ctx, dao.Redis, lockKey) {
-		// 获取锁失败，等待一段时间后重新查询缓存
-		time.Sleep(50 * time.Millisecond)
-		shop, err = dao.GetShopCacheById(ctx, dao.Redis, id)
-		if err == nil && shop != nil {
-			return utils.SuccessResultWithData(shop)
-		}
-		// 如果缓存仍然没有数据，返回错误
-		return utils.ErrorResult("服务繁忙，请稍后重试")
-	}
+// CreateShopRequest 新增商铺请求结构
+type CreateShopRequest struct {
+	Name      string  `json:"name" binding:"required,max=128"`
+	TypeID    uint    `json:"typeId" binding:"required"`
+	Images    string  `json:"images" binding:"max=1024"`
+	Area      string  `json:"area" binding:"max=128"`
+	Address   string  `json:"address" binding:"required,max=255"`
+	X         float64 `json:"x"` // 经度
+	Y         float64 `json:"y"` // 纬度
+	AvgPrice  int     `json:"avgPrice" binding:"min=0"`
+	OpenHours string  `json:"openHours"` // 营业时间，格式 HH:MM-HH:MM
+}
 
-	// 获取锁成功，确保释放锁
-	defer utils.UnLock(ctx, dao.Redis, lockKey)
+// Redis GEO 支持的坐标范围
+const (
+	maxShopLongitude = 180.0
+	maxShopLatitude  = 85.05112878
+)
 
-	// 再次检查缓存（双重检查锁定模式）
-	shop, err = dao.GetShopCacheById(ctx, dao.Redis, id)
-	if err == nil && shop != nil {
-		// 缓存命中，直接返回
-		return utils.SuccessResultWithData(shop)
+// CreateShop 商家新增商铺，创建者即为商铺所属商家
+// 新商铺需要加入布隆过滤器和地理位置缓存，否则在重启前无法被查询和附近搜索到
+func CreateShop(ctx context.Context, userId uint, req *CreateShopRequest) *utils.Result {
+	// 1. 参数校验
+	if strings.TrimSpace(req.Name) == "" {
+		return utils.ErrorResult("商铺名称不能为空")
 	}
-
-	// 4. 查询数据库
-	shop, err = dao.GetShopById(ctx, dao.DB, id)
+	if req.X < -maxShopLongitude || req.X > maxShopLongitude || req.Y < -maxShopLatitude || req.Y > maxShopLatitude {
+		return utils.ErrorResult("商铺坐标无效")
+	}
+	if req.OpenHours != "" && utils.IsOpenHoursInvalid(req.OpenHours) {
+		return utils.ErrorResult("营业时间格式错误，应为 HH:MM-HH:MM")
+	}
+	exists, err := dao.ExistsShopType(ctx, dao.DB, req.TypeID)
 	if err != nil {
-		// 数据库查询失败
-		return utils.ErrorResult("查询失败: " + err.Error())
+		log.Printf("查询商铺类型失败: typeId=%d, error=%v", req.TypeID, err)
+		return utils.ErrorResult("系统错误")
+	}
+	if !exists {
+		return utils.ErrorResult("商铺类型不存在")
 	}
 
-	// 5. 设置缓存
-	err = dao.SetShopCacheById(ctx, dao.Redis, id, shop)
-	if err != nil {
-		// 缓存设置失败，记录日志但不影响返回结果
-		log.Printf("设置缓存失败: %v", err)
+	// 2. 写入数据库
+	shop := &models.Shop{
+		Name:      strings.TrimSpace(req.Name),
+		TypeID:    req.TypeID,
+		Images:    req.Images,
+		Area:      req.Area,
+		Address:   req.Address,
+		X:         req.X,
+		Y:         req.Y,
+		AvgPrice:  req.AvgPrice,
+		OpenHours: req.OpenHours,
+		OwnerID:   userId,
+	}
+	if err := dao.CreateShop(ctx, dao.DB, shop); err != nil {
+		log.Printf("创建商铺失败: %v", err)
+		return utils.ErrorResult("创建商铺失败")
+	}
+
+	// 3. 加入布隆过滤器和地理位置缓存，失败只记录日志，重启时会重新加载
+	if _, err := utils.CreateShopBloomFilter(dao.Redis).AddID(ctx, shop.ID); err != nil {
+		log.Printf("添加商铺到布隆过滤器失败: shopId=%d, error=%v", shop.ID, err)
+	}
+	if err := dao.AddShopLocation(ctx, dao.Redis, shop); err != nil {
+		log.Printf("添加商铺地理位置缓存失败: shopId=%d, error=%v", shop.ID, err)
 	}
 
-	// 6. 返回结果
 	return utils.SuccessResultWithData(shop)
 }
 
-// UpdateShopById 根据ID更新商铺
-func UpdateShopById(ctx context.Context, shop *models.Shop) *utils.Result {
+// UpdateShopRequest 修改商铺信息请求结构，只更新传入的字段；所属商家只能在新增商铺时确定，不允许修改
+type UpdateShopRequest struct {
+	ID        uint     `json:"id" binding:"required"`
+	Name      *string  `json:"name" binding:"omitempty,max=128"`
+	TypeID    *uint    `json:"typeId"`
+	Images    *string  `json:"images" binding:"omitempty,max=1024"`
+	Area      *string  `json:"area" binding:"omitempty,max=128"`
+	Address   *string  `json:"address" binding:"omitempty,max=255"`
+	X         *float64 `json:"x"` // 经度
+	Y         *float64 `json:"y"` // 纬度
+	AvgPrice  *int     `json:"avgPrice" binding:"omitempty,min=0"`
+	OpenHours *string  `json:"openHours"` // 营业时间，格式 HH:MM-HH:MM
+}
+
+// UpdateShopById 商家根据ID更新商铺，需要是商铺所属商家或管理员，只允许修改白名单内的字段
+func UpdateShopById(ctx context.Context, userId uint, req *UpdateShopRequest) *utils.Result {
+	if req.ID == 0 {
+		return utils.ErrorResult("商铺ID不能为空")
+	}
+
+	// 查询更新前的商铺并校验权限，同时用于判断地理位置是否发生变化
+	oldShop, res := getManagedShop(ctx, userId, req.ID)
+	if res != nil {
+		return res
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return utils.ErrorResult("商铺名称不能为空")
+		}
+		updates["name"] = name
+	}
+	if req.TypeID != nil {
+		if *req.TypeID != oldShop.TypeID {
+			exists, err := dao.ExistsShopType(ctx, dao.DB, *req.TypeID)
+			if err != nil {
+				log.Printf("查询商铺类型失败: typeId=%d, error=%v", *req.TypeID, err)
+				return utils.ErrorResult("系统错误")
+			}
+			if !exists {
+				return utils.ErrorResult("商铺类型不存在")
+			}
+		}
+		updates["type_id"] = *req.TypeID
+	}
+	if req.Images != nil {
+		updates["images"] = *req.Images
+	}
+	if req.Area != nil {
+		updates["area"] = *req.Area
+	}
+	if req.Address != nil {
+		updates["address"] = *req.Address
+	}
+	if req.X != nil {
+		if *req.X < -maxShopLongitude || *req.X > maxShopLongitude {
+			return utils.ErrorResult("商铺坐标无效")
+		}
+		updates["x"] = *req.X
+	}
+	if req.Y != nil {
+		if *req.Y < -maxShopLatitude || *req.Y > maxShopLatitude {
+			return utils.ErrorResult("商铺坐标无效")
+		}
+		updates["y"] = *req.Y
+	}
+	if req.AvgPrice != nil {
+		updates["avg_price"] = *req.AvgPrice
+	}
+	if req.OpenHours != nil {
+		if *req.OpenHours != "" && utils.IsOpenHoursInvalid(*req.OpenHours) {
+			return utils.ErrorResult("营业时间格式错误，应为 HH:MM-HH:MM")
+		}
+		updates["open_hours"] = *req.OpenHours
+	}
+	if len(updates) == 0 {
+		return utils.ErrorResult("没有需要修改的字段")
+	}
 
 	// 0. 启动事务
 	tx := dao.DB.Begin()
@@ -84,7 +220,7 @@ func UpdateShopById(ctx context.Context, shop *models.Shop) *utils.Result {
 	}()
 
 	// 1. 更新数据库
-	err := dao.UpdateShop(ctx, tx, shop)
+	err := dao.UpdateShopFields(ctx, tx, req.ID, updates)
 
 	// 2. 更新失败
 	if err != nil {
@@ -99,16 +235,60 @@ func UpdateShopById(ctx context.Context, shop *models.Shop) *utils.Result {
 	}
 
 	// 4. 事务成功后删除缓存（最终一致性）
-	err = dao.DelShopCacheById(ctx, dao.Redis, shop.ID)
+	err = shopCache().Delete(ctx, req.ID)
 	if err != nil {
 		// 记录日志但不影响业务结果
-		log.Printf("警告: 删除缓存失败，商铺ID=%d, 错误=%v", shop.ID, err)
+		log.Printf("警告: 删除缓存失败，商铺ID=%d, 错误=%v", req.ID, err)
 	}
 
-	// 5. 返回结果
+	// 5. 类型或坐标变更时同步地理位置缓存，失败时由重启加载修复
+	newShop, err := dao.GetShopById(ctx, dao.DB, req.ID)
+	if err != nil {
+		log.Printf("警告: 查询更新后的商铺失败，商铺ID=%d, 错误=%v", req.ID, err)
+	} else {
+		if newShop.TypeID != oldShop.TypeID || newShop.X != oldShop.X || newShop.Y != oldShop.Y {
+			if err := dao.MoveShopLocation(ctx, dao.Redis, oldShop, newShop); err != nil {
+				log.Printf("警告: 更新地理位置缓存失败，商铺ID=%d, 错误=%v", req.ID, err)
+			}
+		}
+		// 热点商铺的缓存不会自动过期，直接用最新数据重建
+		if config.GetConfig().Cache.IsHotShop(req.ID) {
+			if err := hotShopCache().SetWithLogicalExpire(ctx, req.ID, newShop); err != nil {
+				log.Printf("警告: 重建热点商铺缓存失败，商铺ID=%d, 错误=%v", req.ID, err)
+			}
+		}
+	}
+
+	// 6. 返回结果
 	return utils.SuccessResult("更新成功")
 }
 
+// DeleteShop 商家删除商铺（软删除），同时移除地理位置和商铺详情缓存
+func DeleteShop(ctx context.Context, userId, shopId uint) *utils.Result {
+	shop, res := getManagedShop(ctx, userId, shopId)
+	if res != nil {
+		return res
+	}
+
+	if err := dao.DeleteShop(ctx, dao.DB, shopId); err != nil {
+		log.Printf("删除商铺失败: shopId=%d, error=%v", shopId, err)
+		return utils.ErrorResult("删除商铺失败")
+	}
+
+	// 布隆过滤器不支持删除，已删除的商铺由缓存和数据库查询兜底
+	if err := dao.RemoveShopLocation(ctx, dao.Redis, shop); err != nil {
+		log.Printf("警告: 移除地理位置缓存失败，商铺ID=%d, 错误=%v", shopId, err)
+	}
+	if err := shopCache().Delete(ctx, shopId); err != nil {
+		log.Printf("警告: 删除缓存失败，商铺ID=%d, 错误=%v", shopId, err)
+	}
+	if err := hotShopCache().Delete(ctx, shopId); err != nil {
+		log.Printf("警告: 删除热点商铺缓存失败，商铺ID=%d, 错误=%v", shopId, err)
+	}
+
+	return utils.SuccessResult("删除成功")
+}
+
 // GetShopList 获取商铺列表
 func GetShopList(page, size int) *utils.Result {
 	var shops []models.Shop
@@ -157,6 +337,82 @@ func GetShopByType(typeId uint, page, size int) *utils.Result {
 	})
 }
 
+// 按位置查询商铺的默认参数
+const (
+	defaultNearbyRadius = 5000.0  // 默认搜索半径（米）
+	maxNearbyRadius     = 50000.0 // 最大搜索半径（米）
+	maxNearbyResults    = 1000    // 最多可以翻到的店铺数量，避免深分页时 GEOSEARCH 返回过多结果
+)
+
+// GetShopByTypeNearby 根据类型查询用户附近的商铺，按距离由近到远分页返回
+// GEOSEARCH 不支持跳过前N条，每次查询到当前页末尾再截取当前页，多查一条用于判断是否还有下一页
+func GetShopByTypeNearby(ctx context.Context, typeId uint, x, y, radius float64, page, size int) *utils.Result {
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 50 {
+		size = 10
+	}
+	if radius <= 0 {
+		radius = defaultNearbyRadius
+	}
+	if radius > maxNearbyRadius {
+		radius = maxNearbyRadius
+	}
+	if x < -maxShopLongitude || x > maxShopLongitude || y < -maxShopLatitude || y > maxShopLatitude {
+		return utils.ErrorResult("坐标无效")
+	}
+
+	// 1. 查询到当前页末尾的店铺
+	from := (page - 1) * size
+	end := page * size
+	if end > maxNearbyResults {
+		return utils.ErrorResult(fmt.Sprintf("最多查询距离最近的 %d 个商铺", maxNearbyResults))
+	}
+	locations, err := dao.SearchShopsByLocation(ctx, dao.Redis, typeId, x, y, radius, end+1)
+	if err != nil {
+		log.Printf("查询附近商铺失败: typeId=%d, error=%v", typeId, err)
+		return utils.ErrorResult("查询失败")
+	}
+	hasMore := len(locations) > end && end < maxNearbyResults
+	if len(locations) > end {
+		locations = locations[:end]
+	}
+
+	// 2. 截取当前页，记录每个店铺的距离
+	shops := []models.Shop{}
+	if from < len(locations) {
+		locations = locations[from:]
+		ids := make([]uint, 0, len(locations))
+		distances := make(map[uint]float64, len(locations))
+		for _, loc := range locations {
+			id, err := strconv.ParseUint(loc.Name, 10, 32)
+			if err != nil {
+				continue
+			}
+			ids = append(ids, uint(id))
+			distances[uint(id)] = loc.Dist
+		}
+
+		// 3. 按距离顺序查询店铺详情
+		shops, err = dao.GetShopsByIDs(ctx, dao.DB, ids)
+		if err != nil {
+			log.Printf("查询商铺失败: %v", err)
+			return utils.ErrorResult("查询失败")
+		}
+		for i := range shops {
+			shops[i].Distance = distances[shops[i].ID]
+		}
+	}
+
+	return utils.SuccessResultWithData(map[string]interface{}{
+		"list":    shops,
+		"page":    page,
+		"size":    size,
+		"hasMore": hasMore,
+	})
+}
+
 // GetShopByName 根据名称搜索商铺
 func GetShopByName(name string, page, size int) *utils.Result {
 	var shops []models.Shop
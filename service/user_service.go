@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"log"
 	"time"
 
 	"hm-dianping-go/dao"
@@ -106,7 +107,7 @@ func UserLogin(phone, code string) *utils.Result {
 
 // GetUserInfo 获取用户信息服务
 func GetUserInfo(userID uint) *utils.Result {
-	user, err := dao.GetUserByID(userID)
+	user, err := userCache().QueryWithMutex(context.Background(), userID, loadUser)
 	if err != nil {
 		return utils.ErrorResult("用户不存在")
 	}
@@ -136,6 +137,9 @@ func UpdateUserInfo(userID uint, nickName, icon string) *utils.Result {
 	if err := dao.UpdateUser(user); err != nil {
 		return utils.ErrorResult("更新失败")
 	}
+	if err := userCache().Delete(context.Background(), userID); err != nil {
+		log.Printf("删除用户缓存失败: userId=%d, error=%v", userID, err)
+	}
 
 	return utils.SuccessResult("更新成功")
 }
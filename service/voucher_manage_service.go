@@ -0,0 +1,351 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"hm-dianping-go/config"
+	"hm-dianping-go/dao"
+	"hm-dianping-go/models"
+	"hm-dianping-go/script"
+	"hm-dianping-go/utils"
+	"log"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 秒杀券库存调整脚本返回值
+const (
+	stockAdjustSuccess        = 0 // 调整成功
+	stockAdjustNotInitialized = 1 // 库存缓存不存在
+	stockAdjustInsufficient   = 2 // 剩余库存不足以减少
+)
+
+// UpdateVoucherRequest 修改优惠券信息请求结构，只更新传入的字段
+type UpdateVoucherRequest struct {
+	Title       *string `json:"title" binding:"omitempty,min=1"`
+	SubTitle    *string `json:"subTitle"`
+	Rules       *string `json:"rules"`
+	PayValue    *int64  `json:"payValue" binding:"omitempty,min=1"`
+	ActualValue *int64  `json:"actualValue" binding:"omitempty,min=1"`
+}
+
+// UpdateVoucherTimeRequest 修改优惠券有效期请求结构
+type UpdateVoucherTimeRequest struct {
+	BeginTime time.Time `json:"beginTime" binding:"required"`
+	EndTime   time.Time `json:"endTime" binding:"required"`
+}
+
+// checkShopManager 校验用户是否有权管理商铺：商铺所属商家或管理员
+func checkShopManager(ctx context.Context, userId, shopId uint) *utils.Result {
+	_, res := getManagedShop(ctx, userId, shopId)
+	return res
+}
+
+// getManagedShop 查询商铺并校验用户是否有权管理
+func getManagedShop(ctx context.Context, userId, shopId uint) (*models.Shop, *utils.Result) {
+	shop, err := dao.GetShopById(ctx, dao.DB, shopId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrorResult("商铺不存在")
+		}
+		log.Printf("查询商铺失败: shopId=%d, error=%v", shopId, err)
+		return nil, utils.ErrorResult("系统错误")
+	}
+	if config.GetConfig().Admin.IsAdmin(userId) {
+		return shop, nil
+	}
+	if shop.OwnerID == 0 || shop.OwnerID != userId {
+		return nil, utils.ErrorResult("无权管理该商铺")
+	}
+	return shop, nil
+}
+
+// getManagedVoucher 查询优惠券并校验用户是否有权管理
+func getManagedVoucher(ctx context.Context, userId, voucherId uint) (*models.Voucher, *utils.Result) {
+	voucher, err := dao.GetVoucherByID(ctx, dao.DB, voucherId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.ErrorResult("优惠券不存在")
+		}
+		log.Printf("查询优惠券失败: voucherId=%d, error=%v", voucherId, err)
+		return nil, utils.ErrorResult("系统错误")
+	}
+	if res := checkShopManager(ctx, userId, voucher.ShopID); res != nil {
+		return nil, res
+	}
+	return voucher, nil
+}
+
+// addVoucherToBloomFilter 将新建的优惠券ID加入布隆过滤器，失败只记录日志
+// 布隆过滤器不支持删除，删除优惠券后ID仍会保留在过滤器中，由数据库查询兜底
+func addVoucherToBloomFilter(ctx context.Context, voucherId uint) {
+	if _, err := utils.CreateVoucherBloomFilter(dao.Redis).AddID(ctx, voucherId); err != nil {
+		log.Printf("添加优惠券到布隆过滤器失败: voucherId=%d, error=%v", voucherId, err)
+	}
+}
+
+// UpdateVoucher 商家修改优惠券信息
+func UpdateVoucher(ctx context.Context, userId, voucherId uint, req *UpdateVoucherRequest) *utils.Result {
+	voucher, res := getManagedVoucher(ctx, userId, voucherId)
+	if res != nil {
+		return res
+	}
+
+	// 与新增秒杀券相同的价格约束，只修改其中一个金额时与当前值合并后校验
+	payValue, actualValue := voucher.PayValue, voucher.ActualValue
+	if req.PayValue != nil {
+		payValue = *req.PayValue
+	}
+	if req.ActualValue != nil {
+		actualValue = *req.ActualValue
+	}
+	if payValue <= actualValue {
+		return utils.ErrorResult("支付金额必须大于实际价值")
+	}
+
+	updates := map[string]interface{}{}
+	if req.Title != nil {
+		updates["title"] = *req.Title
+	}
+	if req.SubTitle != nil {
+		updates["sub_title"] = *req.SubTitle
+	}
+	if req.Rules != nil {
+		updates["rules"] = *req.Rules
+	}
+	if req.PayValue != nil {
+		updates["pay_value"] = *req.PayValue
+	}
+	if req.ActualValue != nil {
+		updates["actual_value"] = *req.ActualValue
+	}
+	if len(updates) == 0 {
+		return utils.ErrorResult("没有需要修改的字段")
+	}
+
+	if err := dao.UpdateVoucherFields(ctx, dao.DB, voucherId, updates); err != nil {
+		log.Printf("修改优惠券失败: voucherId=%d, error=%v", voucherId, err)
+		return utils.ErrorResult("修改优惠券失败")
+	}
+	return utils.SuccessResult("修改成功")
+}
+
+// UpdateVoucherStatus 商家上架/下架优惠券，秒杀券同步更新Redis中的状态
+func UpdateVoucherStatus(ctx context.Context, userId, voucherId uint, status int) *utils.Result {
+	if status != 1 && status != 2 {
+		return utils.ErrorResult("无效的优惠券状态")
+	}
+	voucher, res := getManagedVoucher(ctx, userId, voucherId)
+	if res != nil {
+		return res
+	}
+
+	if err := dao.UpdateVoucherFields(ctx, dao.DB, voucherId, map[string]interface{}{"status": status}); err != nil {
+		log.Printf("修改优惠券状态失败: voucherId=%d, error=%v", voucherId, err)
+		return utils.ErrorResult("修改优惠券状态失败")
+	}
+
+	if voucher.Type == 1 {
+		if err := dao.SetSeckillVoucherStatusCache(ctx, dao.Redis, voucherId, status); err != nil {
+			log.Printf("同步秒杀券状态缓存失败: voucherId=%d, error=%v", voucherId, err)
+			return utils.ErrorResult("同步缓存失败，请重试")
+		}
+	}
+	return utils.SuccessResult("修改成功")
+}
+
+// UpdateVoucherTime 商家修改优惠券有效期，秒杀券同步更新秒杀时间及Redis中的时间缓存
+func UpdateVoucherTime(ctx context.Context, userId, voucherId uint, req *UpdateVoucherTimeRequest) *utils.Result {
+	if !req.EndTime.After(req.BeginTime) {
+		return utils.ErrorResult("结束时间必须晚于开始时间")
+	}
+	if !req.EndTime.After(time.Now()) {
+		return utils.ErrorResult("结束时间必须晚于当前时间")
+	}
+	voucher, res := getManagedVoucher(ctx, userId, voucherId)
+	if res != nil {
+		return res
+	}
+
+	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		return utils.ErrorResult("事务开启失败")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := dao.UpdateVoucherFields(ctx, tx, voucherId, map[string]interface{}{
+		"begin_time": req.BeginTime,
+		"end_time":   req.EndTime,
+	}); err != nil {
+		tx.Rollback()
+		log.Printf("修改优惠券有效期失败: voucherId=%d, error=%v", voucherId, err)
+		return utils.ErrorResult("修改有效期失败")
+	}
+	if voucher.Type == 1 {
+		if err := dao.UpdateSeckillVoucherTime(ctx, tx, voucherId, req.BeginTime, req.EndTime); err != nil {
+			tx.Rollback()
+			log.Printf("修改秒杀时间失败: voucherId=%d, error=%v", voucherId, err)
+			return utils.ErrorResult("修改有效期失败")
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return utils.ErrorResult("事务提交失败")
+	}
+
+	if voucher.Type == 1 {
+		seckillVoucher, err := dao.GetSeckillVoucherByID(voucherId)
+		if err != nil {
+			log.Printf("查询秒杀券失败: voucherId=%d, error=%v", voucherId, err)
+			return utils.ErrorResult("同步缓存失败，请重试")
+		}
+		// 延长已结束的秒杀券时，库存缓存可能已不存在，通过预热补齐
+		if _, err := WarmUpSeckillVoucher(ctx, seckillVoucher); err != nil {
+			log.Printf("同步秒杀券缓存失败: %v", err)
+			return utils.ErrorResult("同步缓存失败，请重试")
+		}
+	}
+	return utils.SuccessResult("修改成功")
+}
+
+// AdjustVoucherStock 商家调整优惠券库存，delta 为负数时减少库存
+// 秒杀券先在Redis中调整（秒杀资格以Redis库存为准），再调整数据库
+func AdjustVoucherStock(ctx context.Context, userId, voucherId uint, delta int) *utils.Result {
+	if delta == 0 {
+		return utils.ErrorResult("库存调整量不能为0")
+	}
+	voucher, res := getManagedVoucher(ctx, userId, voucherId)
+	if res != nil {
+		return res
+	}
+
+	if voucher.Type != 1 {
+		if err := dao.AdjustVoucherStock(ctx, dao.DB, voucherId, delta); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return utils.ErrorResult("剩余库存不足")
+			}
+			log.Printf("调整优惠券库存失败: voucherId=%d, error=%v", voucherId, err)
+			return utils.ErrorResult("调整库存失败")
+		}
+		return utils.SuccessResult("调整成功")
+	}
+
+	// 1. 调整Redis库存，库存缓存不存在时只调整数据库，由预热流程加载
+	r, err := runStockAdjustScript(ctx, voucherId, delta)
+	if err != nil {
+		log.Printf("执行库存调整脚本失败: voucherId=%d, error=%v", voucherId, err)
+		return utils.ErrorResult("系统错误")
+	}
+	if r == stockAdjustInsufficient {
+		return utils.ErrorResult("剩余库存不足")
+	}
+
+	// 2. 调整数据库库存，秒杀券表为剩余库存，优惠券表为发行总量
+	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		revertStockAdjust(ctx, voucherId, delta, r)
+		return utils.ErrorResult("事务开启失败")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := dao.AdjustSeckillVoucherStock(ctx, tx, voucherId, delta); err != nil {
+		tx.Rollback()
+		revertStockAdjust(ctx, voucherId, delta, r)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResult("剩余库存不足")
+		}
+		log.Printf("调整秒杀券库存失败: voucherId=%d, error=%v", voucherId, err)
+		return utils.ErrorResult("调整库存失败")
+	}
+	if err := dao.AdjustVoucherStock(ctx, tx, voucherId, delta); err != nil {
+		tx.Rollback()
+		revertStockAdjust(ctx, voucherId, delta, r)
+		log.Printf("调整优惠券库存失败: voucherId=%d, error=%v", voucherId, err)
+		return utils.ErrorResult("调整库存失败")
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		revertStockAdjust(ctx, voucherId, delta, r)
+		return utils.ErrorResult("事务提交失败")
+	}
+	if delta > 0 {
+		notifySeckillStockReplenished(ctx, voucherId)
+	}
+	return utils.SuccessResult("调整成功")
+}
+
+// runStockAdjustScript 执行秒杀券库存调整脚本
+func runStockAdjustScript(ctx context.Context, voucherId uint, delta int) (int, error) {
+	return script.SeckillStockAdjust.Run(ctx, dao.Redis, []string{},
+		strconv.Itoa(int(voucherId)), delta).Int()
+}
+
+// revertStockAdjust 数据库调整失败时撤销Redis中的库存调整，撤销失败由对账任务修复
+func revertStockAdjust(ctx context.Context, voucherId uint, delta, adjustResult int) {
+	if adjustResult != stockAdjustSuccess {
+		return
+	}
+	if r, err := runStockAdjustScript(ctx, voucherId, -delta); err != nil || r != stockAdjustSuccess {
+		log.Printf("撤销Redis库存调整失败: voucherId=%d, delta=%d, result=%d, error=%v", voucherId, delta, r, err)
+	}
+}
+
+// DeleteVoucher 商家删除优惠券，秒杀券同时删除秒杀信息和Redis缓存，已产生的订单不受影响
+func DeleteVoucher(ctx context.Context, userId, voucherId uint) *utils.Result {
+	voucher, res := getManagedVoucher(ctx, userId, voucherId)
+	if res != nil {
+		return res
+	}
+
+	// 先将秒杀券标记为下架，保证后续删除缓存失败时秒杀脚本也会拒绝该秒杀券
+	if voucher.Type == 1 {
+		if err := dao.SetSeckillVoucherStatusCache(ctx, dao.Redis, voucherId, 2); err != nil {
+			log.Printf("下架秒杀券失败: voucherId=%d, error=%v", voucherId, err)
+			return utils.ErrorResult("系统错误")
+		}
+	}
+
+	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		return utils.ErrorResult("事务开启失败")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := dao.DeleteVoucher(ctx, tx, voucherId); err != nil {
+		tx.Rollback()
+		log.Printf("删除优惠券失败: voucherId=%d, error=%v", voucherId, err)
+		return utils.ErrorResult("删除优惠券失败")
+	}
+	if voucher.Type == 1 {
+		if err := dao.DeleteSeckillVoucher(ctx, tx, voucherId); err != nil {
+			tx.Rollback()
+			log.Printf("删除秒杀券失败: voucherId=%d, error=%v", voucherId, err)
+			return utils.ErrorResult("删除优惠券失败")
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return utils.ErrorResult("事务提交失败")
+	}
+
+	if voucher.Type == 1 {
+		if err := dao.DelSeckillVoucherCache(ctx, dao.Redis, voucherId); err != nil {
+			log.Printf("删除秒杀券缓存失败: voucherId=%d, error=%v", voucherId, err)
+		}
+	}
+	return utils.SuccessResult("删除成功")
+}
@@ -2,17 +2,22 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hm-dianping-go/config"
 	"hm-dianping-go/dao"
 	"hm-dianping-go/models"
+	"hm-dianping-go/script"
 	"hm-dianping-go/utils"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
 )
 
 // SeckillVoucher 秒杀优惠券（使用乐观锁）
@@ -59,7 +64,7 @@ import (
 // 		}
 
 // 		// 扣减库存（乐观锁CAS操作）
-// 		err = dao.UpdateSeckillVoucherStock(voucherId, 1)
+// 		err = dao.UpdateSeckillVoucherStock(ctx, tx, voucherId, 1)
 // 		if err != nil {
 // 			tx.Rollback()
 // 			if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -292,42 +297,249 @@ ON tb_voucher_order (user_id, voucher_id, voucher_type);
 // 	}
 // }
 
+// 订单ID生成相关配置
+const (
+	orderIdKeyPrefix = "order" // 订单ID自增key前缀
+	orderIdCountBits = 20      // 序列号位数，毫秒时间戳左移20位，保证ID不超过int64范围
+)
+
+var (
+	orderIdWorker     *utils.RedisIdWorker // 订单全局ID生成器
+	orderIdWorkerOnce sync.Once            // 确保ID生成器只初始化一次
+)
+
+// nextOrderId 生成全局唯一的订单ID
+func nextOrderId(ctx context.Context) (int64, error) {
+	orderIdWorkerOnce.Do(func() {
+		orderIdWorker = utils.NewRedisIdWorker(dao.Redis, orderIdCountBits)
+	})
+	return orderIdWorker.NextId(ctx, orderIdKeyPrefix)
+}
+
+// 秒杀脚本返回值
+const (
+	seckillSuccess        = 0 // 获得购买资格，订单已写入Stream
+	seckillOutOfStock     = 1 // 库存不足
+	seckillDuplicate      = 2 // 已达到每人限购数量
+	seckillNotInitialized = 3 // 秒杀券缓存未初始化
+	seckillNotStarted     = 4 // 秒杀尚未开始
+	seckillEnded          = 5 // 秒杀已结束
+	seckillOffline        = 6 // 秒杀券已下架
+	seckillNoPermit       = 7 // 排队秒杀券未持有购买许可
+)
+
 // SeckillVoucher 秒杀优惠券
 func SeckillVoucher(ctx context.Context, userId, voucherId uint) *utils.Result {
-	// 从文件当中加载脚本
-	script, err := os.ReadFile("script/seckill.lua")
+	// 已售罄的秒杀券直接在本地拒绝，不再访问Redis
+	if isSeckillSoldOut(voucherId) {
+		return utils.ErrorResult(seckillFailMessage(seckillOutOfStock))
+	}
+
+	// 0. 在执行脚本之前生成订单ID，保证客户端拿到的ID与最终落库的ID一致
+	orderId, err := nextOrderId(ctx)
 	if err != nil {
-		log.Printf("读取秒杀脚本失败: %v", err)
+		log.Printf("生成订单ID失败: %v", err)
 		return utils.ErrorResult("系统错误")
 	}
-	scriptStr := string(script)
 
 	// 1. 执行Lua脚本
-	result := dao.Redis.Eval(ctx, scriptStr, []string{}, strconv.Itoa(int(voucherId)), strconv.Itoa(int(userId)))
-	if result.Err() != nil {
-		log.Printf("执行秒杀脚本失败: %v", result.Err())
+	r, err := runSeckillScript(ctx, voucherId, userId, uint(orderId), false)
+	if err != nil {
+		log.Printf("执行秒杀脚本失败: %v", err)
 		return utils.ErrorResult("系统错误")
 	}
 
 	// 2. 判断结果是否为 0，0的时候有资格完成
-	r, err := result.Int()
+	if r != seckillSuccess {
+		switch r {
+		case seckillOutOfStock:
+			markSeckillSoldOut(voucherId)
+		case seckillNotInitialized:
+			log.Printf("秒杀券库存缓存未初始化: voucherId=%d", voucherId)
+		}
+		return utils.ErrorResult(seckillFailMessage(r))
+	}
+
+	// 3. 已经加入到消息队列了
+
+	// 4. 返回订单ID，客户端可以凭此ID查询订单处理结果
+	// 订单ID超出了JS的安全整数范围，以字符串形式返回
+	return utils.SuccessResultWithData(map[string]interface{}{
+		"orderId": strconv.FormatInt(orderId, 10),
+		"message": "秒杀成功，订单处理中...",
+	})
+}
+
+// runSeckillScript 执行秒杀脚本：校验资格、预扣库存并将订单写入Stream
+// replay 为 true 时表示重新投递死信订单，原订单已经通过了秒杀时间和排队许可校验，脚本不再检查这两项
+func runSeckillScript(ctx context.Context, voucherId, userId, orderId uint, replay bool) (int, error) {
+	replayFlag := "0"
+	if replay {
+		replayFlag = "1"
+	}
+	return script.Seckill.Run(ctx, dao.Redis, []string{},
+		strconv.Itoa(int(voucherId)), strconv.Itoa(int(userId)), strconv.FormatUint(uint64(orderId), 10), replayFlag).Int()
+}
+
+// BuyNormalVoucher 购买普通优惠券，同步扣减库存并创建订单，允许重复购买
+func BuyNormalVoucher(ctx context.Context, userId, voucherId uint) *utils.Result {
+	// 1. 查询优惠券并校验
+	voucher, err := dao.GetVoucherByID(ctx, dao.DB, voucherId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrorResult("优惠券不存在")
+		}
+		log.Printf("查询优惠券失败: voucherId=%d, error=%v", voucherId, err)
+		return utils.ErrorResult("系统错误")
+	}
+	if voucher.Type != 0 {
+		return utils.ErrorResult("该优惠券不是普通券")
+	}
+	if voucher.Status != 1 {
+		return utils.ErrorResult("优惠券已下架")
+	}
+	now := time.Now()
+	if voucher.BeginTime != nil && now.Before(*voucher.BeginTime) {
+		return utils.ErrorResult("优惠券尚未开售")
+	}
+	if voucher.EndTime != nil && now.After(*voucher.EndTime) {
+		return utils.ErrorResult("优惠券已过期")
+	}
+	if voucher.Stock < 1 {
+		return utils.ErrorResult("库存不足")
+	}
+
+	// 2. 生成订单ID
+	orderId, err := nextOrderId(ctx)
 	if err != nil {
-		log.Printf("获取秒杀脚本返回值失败: %v", err)
+		log.Printf("生成订单ID失败: %v", err)
 		return utils.ErrorResult("系统错误")
 	}
-	if r != 0 {
-		if r == 1 {
+
+	// 3. 扣减库存与创建订单在同一事务中
+	tx := dao.DB.Begin()
+	if tx.Error != nil {
+		return utils.ErrorResult("事务开启失败")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := dao.DecrVoucherStock(ctx, tx, voucherId, 1); err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return utils.ErrorResult("库存不足")
 		}
-		return utils.ErrorResult("不能重复购买")
+		log.Printf("扣减优惠券库存失败: voucherId=%d, error=%v", voucherId, err)
+		return utils.ErrorResult("系统错误")
 	}
 
-	// 3. 已经加入到消息队列了
+	order := &models.VoucherOrder{
+		ID:          uint(orderId),
+		UserID:      userId,
+		VoucherID:   voucherId,
+		PayType:     1,
+		Status:      models.OrderStatusUnpaid,
+		CreateTime:  &now,
+		VoucherType: 1, // 普通券类型
+	}
+	if err := dao.CreateVoucherOrder(ctx, tx, order); err != nil {
+		tx.Rollback()
+		log.Printf("创建订单失败: userId=%d, voucherId=%d, error=%v", userId, voucherId, err)
+		return utils.ErrorResult("创建订单失败")
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return utils.ErrorResult("事务提交失败")
+	}
+
+	return utils.SuccessResultWithData(map[string]interface{}{
+		"orderId": strconv.FormatInt(orderId, 10),
+		"order":   order,
+	})
+}
+
+// seckillFailMessage 将秒杀脚本的失败返回值转换为提示信息
+func seckillFailMessage(code int) string {
+	switch code {
+	case seckillOutOfStock:
+		return "库存不足"
+	case seckillDuplicate:
+		return "已达到每人限购数量"
+	case seckillNotInitialized:
+		return "秒杀券不存在或库存未初始化"
+	case seckillNotStarted:
+		return "秒杀尚未开始"
+	case seckillEnded:
+		return "秒杀已结束"
+	case seckillOffline:
+		return "优惠券已下架"
+	case seckillNoPermit:
+		return "请先排队，放行后再抢购"
+	default:
+		return "系统错误"
+	}
+}
+
+// compensatedKeyPrefix 订单补偿标记key前缀，与 script/seckill_compensate.lua 保持一致
+const compensatedKeyPrefix = "seckill:compensated:"
+
+// errInvalidOrderMessage 订单消息内容无法解析，这类消息无法进行库存补偿
+var errInvalidOrderMessage = errors.New("订单消息内容无效")
+
+// errSeckillOrderRejected 订单因消息无效、库存不足或超出限购而无法创建，重试也无法成功，直接转入死信队列
+// 未使用该错误包装的失败（数据库、Redis连接异常等）视为瞬时错误，退避后继续重试
+var errSeckillOrderRejected = errors.New("订单无法创建")
+
+// 库存补偿脚本返回值
+const (
+	compensateSuccess  = 0 // 已回补库存并释放购买资格
+	compensateRepeated = 1 // 该订单已经补偿过
+	compensateReleased = 2 // 用户购买资格已释放，无需回补
+)
+
+// compensateSeckillOrder 订单最终创建失败时，回补Redis库存并扣减用户已购数量，使其可以重新抢购
+func compensateSeckillOrder(ctx context.Context, voucherId, userId, orderId uint, reason string) error {
+	r, err := script.SeckillCompensate.Run(ctx, dao.Redis, []string{},
+		strconv.Itoa(int(voucherId)), strconv.Itoa(int(userId)), strconv.FormatUint(uint64(orderId), 10), reason).Int()
+	if err != nil {
+		return fmt.Errorf("执行库存补偿脚本失败: %v", err)
+	}
 
-	// 4. 返回订单ID（这里可以生成一个临时ID或者返回成功信息）
-	return utils.SuccessResultWithData("秒杀成功，订单处理中...")
+	switch r {
+	case compensateSuccess:
+		log.Printf("库存补偿完成: voucherId=%d, userId=%d, orderId=%d, reason=%s", voucherId, userId, orderId, reason)
+		notifySeckillStockReplenished(ctx, voucherId)
+	case compensateRepeated:
+		log.Printf("订单已补偿过，跳过: orderId=%d", orderId)
+	case compensateReleased:
+		log.Printf("用户购买资格已释放，无需补偿: voucherId=%d, userId=%d, orderId=%d", voucherId, userId, orderId)
+	}
+	return nil
+}
+
+// compensateFromMessage 根据订单消息内容执行库存补偿
+func compensateFromMessage(ctx context.Context, values map[string]interface{}, reason string) error {
+	userID, err := strconv.ParseUint(fmt.Sprint(values["userId"]), 10, 32)
+	if err != nil {
+		return fmt.Errorf("%w: 解析用户ID失败: %v", errInvalidOrderMessage, err)
+	}
+	voucherID, err := strconv.ParseUint(fmt.Sprint(values["voucherId"]), 10, 32)
+	if err != nil {
+		return fmt.Errorf("%w: 解析优惠券ID失败: %v", errInvalidOrderMessage, err)
+	}
+	orderID, err := strconv.ParseUint(fmt.Sprint(values["id"]), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: 解析订单ID失败: %v", errInvalidOrderMessage, err)
+	}
+	return compensateSeckillOrder(ctx, uint(voucherID), uint(userID), uint(orderID), reason)
 }
 
+// deadLetterMaxLen 死信队列最多保留的消息数（近似裁剪），避免长期无人处理时无限增长
+const deadLetterMaxLen = 100000
+
 // StreamOrderInfo Redis Stream中的订单信息结构体
 type StreamOrderInfo struct {
 	UserID    string `json:"userId"`
@@ -338,8 +550,10 @@ type StreamOrderInfo struct {
 // Stream消费者相关配置
 var (
 	streamKey     = "stream.orders"     // Stream名称
+	deadLetterKey = "stream.orders.dlq" // 死信队列Stream名称
 	groupName     = "order-group"       // 消费者组名称
 	consumerCount = 3                   // 消费者数量
+	consumerNames []string              // 当前进程的消费者名称，进程间唯一
 	streamOnce    sync.Once             // 确保Stream只初始化一次
 	stopChan      = make(chan struct{}) // 停止信号
 	wg            sync.WaitGroup        // 等待组，用于优雅关闭
@@ -380,20 +594,35 @@ func InitStreamConsumer() error {
 			return
 		}
 
-		// 3. 启动消费者
+		// 3. 启动消费者，消费者名称带上进程标识，避免多实例部署时在消费者组中冲突
+		prefix := newConsumerPrefix()
 		for i := 0; i < consumerCount; i++ {
-			consumerName := fmt.Sprintf("consumer-%d", i)
+			consumerName := fmt.Sprintf("%s-consumer-%d", prefix, i)
+			consumerNames = append(consumerNames, consumerName)
 			wg.Add(1)
 			go streamConsumer(consumerName, i)
 		}
 
-		log.Printf("Redis Stream消费者初始化完成，Stream: %s, 消费者组: %s, 消费者数量: %d",
-			streamKey, groupName, consumerCount)
+		// 4. 启动pending消息认领任务，接管已崩溃消费者遗留的消息
+		wg.Add(1)
+		go pendingSweeper(consumerNames[0])
+
+		log.Printf("Redis Stream消费者初始化完成，Stream: %s, 消费者组: %s, 消费者: %v",
+			streamKey, groupName, consumerNames)
 	})
 
 	return initErr
 }
 
+// newConsumerPrefix 生成当前进程唯一的消费者名称前缀：主机名-进程号-随机串
+func newConsumerPrefix() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), utils.GenerateAlphaNumString(6))
+}
+
 // checkStreamExists 检查Stream是否存在
 func checkStreamExists(ctx context.Context, streamKey string) (bool, error) {
 	result := dao.Redis.Exists(ctx, streamKey)
@@ -426,12 +655,15 @@ func streamConsumer(consumerName string, workerID int) {
 			}
 
 			// 处理每条消息
+			var backoff time.Duration
 			for _, msg := range messages {
 				err := processStreamMessage(ctx, msg, consumerName)
 				if err != nil {
 					log.Printf("消费者 %s 处理消息失败: msgID=%s, error=%v",
 						consumerName, msg.ID, err)
-					// 这里可以添加重试逻辑或将失败消息放入死信队列
+					if d := handleFailedMessage(ctx, msg, consumerName, err); d > backoff {
+						backoff = d
+					}
 				} else {
 					log.Printf("消费者 %s 成功处理消息: msgID=%s", consumerName, msg.ID)
 					// 确认消息已处理
@@ -439,9 +671,14 @@ func streamConsumer(consumerName string, workerID int) {
 				}
 			}
 
-			// 如果没有消息，短暂休眠
+			// 如果没有消息，短暂休眠；出现瞬时错误时按退避时间等待，避免对故障资源密集重试
 			if len(messages) == 0 {
 				time.Sleep(time.Millisecond * 100)
+			} else if backoff > 0 {
+				select {
+				case <-stopChan:
+				case <-time.After(backoff):
+				}
 			}
 		}
 	}
@@ -482,27 +719,220 @@ func readStreamMessages(ctx context.Context, consumerName string) ([]redis.XMess
 	return []redis.XMessage{}, nil
 }
 
+// pendingSweeper 定期认领其他消费者长时间未确认的消息
+// 被认领的消息进入 consumerName 的pending列表，由该消费者在下一轮读取时处理
+func pendingSweeper(consumerName string) {
+	defer wg.Done()
+
+	cfg := config.GetConfig().Seckill
+	minIdle := time.Duration(cfg.ClaimMinIdle) * time.Second
+	ticker := time.NewTicker(time.Duration(cfg.ClaimInterval) * time.Second)
+	defer ticker.Stop()
+
+	ctx := context.Background()
+	for {
+		select {
+		case <-stopChan:
+			log.Printf("pending消息认领任务收到停止信号，正在退出")
+			return
+		case <-ticker.C:
+			claimed, err := claimStaleMessages(ctx, consumerName, minIdle)
+			if err != nil {
+				log.Printf("认领pending消息失败: %v", err)
+				continue
+			}
+			if claimed > 0 {
+				log.Printf("消费者 %s 认领了 %d 条空闲超过 %v 的pending消息", consumerName, claimed, minIdle)
+			}
+		}
+	}
+}
+
+// claimStaleMessages 扫描消费者组的pending列表，将空闲超过 minIdle 的消息认领给 consumerName
+func claimStaleMessages(ctx context.Context, consumerName string, minIdle time.Duration) (int, error) {
+	const batchSize = 100
+	claimed := 0
+	start := "-"
+
+	for {
+		pending, err := dao.Redis.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: streamKey,
+			Group:  groupName,
+			Start:  start,
+			End:    "+",
+			Count:  batchSize,
+		}).Result()
+		if err != nil {
+			return claimed, err
+		}
+
+		var ids []string
+		for _, p := range pending {
+			if p.Consumer != consumerName && p.Idle >= minIdle {
+				ids = append(ids, p.ID)
+			}
+		}
+
+		if len(ids) > 0 {
+			// JUSTID 不会增加消息的投递次数，真正的投递计数在消费者读取时累加
+			result, err := dao.Redis.XClaimJustID(ctx, &redis.XClaimArgs{
+				Stream:   streamKey,
+				Group:    groupName,
+				Consumer: consumerName,
+				MinIdle:  minIdle,
+				Messages: ids,
+			}).Result()
+			if err != nil {
+				return claimed, err
+			}
+			claimed += len(result)
+		}
+
+		if len(pending) < batchSize {
+			return claimed, nil
+		}
+		start = nextStreamID(pending[len(pending)-1].ID)
+	}
+}
+
+// nextStreamID 计算紧随给定ID之后的Stream消息ID，用于分页扫描
+func nextStreamID(id string) string {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return id
+	}
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return id
+	}
+	return parts[0] + "-" + strconv.FormatUint(seq+1, 10)
+}
+
+// 瞬时错误重试的退避时间，从 minRetryBackoff 开始按投递次数翻倍，最长 maxRetryBackoff
+// maxRetryBackoff 需要小于 claim_min_idle，避免退避中的消息被其他消费者认领
+const (
+	minRetryBackoff = time.Second
+	maxRetryBackoff = 30 * time.Second
+)
+
+// handleFailedMessage 处理失败的消息，返回消费者再次读取前需要等待的退避时间
+// 无法创建的订单直接转入死信队列；瞬时错误保留在pending列表中按指数退避重试，不会转入死信队列，
+// 避免数据库短暂故障时把已扣减库存的有效订单补偿掉
+func handleFailedMessage(ctx context.Context, msg redis.XMessage, consumerName string, procErr error) time.Duration {
+	attempts, err := getDeliveryCount(ctx, msg.ID)
+	if err != nil {
+		log.Printf("消费者 %s 查询消息投递次数失败: msgID=%s, error=%v", consumerName, msg.ID, err)
+		return minRetryBackoff
+	}
+
+	if !errors.Is(procErr, errSeckillOrderRejected) {
+		maxAttempts := int64(config.GetConfig().Seckill.MaxDeliveryAttempts)
+		if attempts >= maxAttempts {
+			log.Printf("消费者 %s 消息持续处理失败，请检查数据库等依赖服务: msgID=%s, 已投递%d次",
+				consumerName, msg.ID, attempts)
+		}
+		backoff := retryBackoff(attempts)
+		log.Printf("消费者 %s 消息将在 %v 后重试: msgID=%s, 已投递%d次", consumerName, backoff, msg.ID, attempts)
+		return backoff
+	}
+
+	if err := moveToDeadLetter(ctx, msg, attempts, procErr.Error()); err != nil {
+		log.Printf("消费者 %s 消息转入死信队列失败: msgID=%s, error=%v", consumerName, msg.ID, err)
+		return minRetryBackoff
+	}
+	log.Printf("消费者 %s 订单无法创建，消息已转入死信队列: msgID=%s", consumerName, msg.ID)
+	return 0
+}
+
+// retryBackoff 根据已投递次数计算指数退避时间
+func retryBackoff(attempts int64) time.Duration {
+	backoff := minRetryBackoff
+	for i := int64(1); i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	return backoff
+}
+
+// getDeliveryCount 通过XPENDING获取消息的投递次数
+func getDeliveryCount(ctx context.Context, msgID string) (int64, error) {
+	pending, err := dao.Redis.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: streamKey,
+		Group:  groupName,
+		Start:  msgID,
+		End:    msgID,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+	return pending[0].RetryCount, nil
+}
+
+// moveToDeadLetter 回补库存后将消息写入死信队列并确认原消息，同时标记订单处理失败
+func moveToDeadLetter(ctx context.Context, msg redis.XMessage, attempts int64, reason string) error {
+	// 订单无法创建，回补Lua脚本预扣的库存并释放用户的购买资格
+	compensated := "1"
+	if err := compensateFromMessage(ctx, msg.Values, "dlq"); err != nil {
+		log.Printf("死信消息库存补偿失败: msgID=%s, error=%v", msg.ID, err)
+		compensated = "0"
+	}
+
+	values := make(map[string]interface{}, len(msg.Values)+5)
+	for k, v := range msg.Values {
+		values[k] = v
+	}
+	values["sourceId"] = msg.ID
+	values["reason"] = reason
+	values["attempts"] = attempts
+	values["failedAt"] = time.Now().Format(time.RFC3339)
+	values["compensated"] = compensated
+
+	pipe := dao.Redis.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{Stream: deadLetterKey, MaxLen: deadLetterMaxLen, Approx: true, ID: "*", Values: values})
+	pipe.XAck(ctx, streamKey, groupName, msg.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	// 标记订单处理失败，客户端轮询时可以看到失败原因
+	if orderID, err := strconv.ParseUint(fmt.Sprint(msg.Values["id"]), 10, 64); err == nil {
+		markSeckillOrderStatus(ctx, uint(orderID), dao.SeckillOrderFailed, reason)
+	}
+	return nil
+}
+
 // processStreamMessage 处理单条Stream消息
 func processStreamMessage(ctx context.Context, msg redis.XMessage, consumerName string) error {
 	// 解析消息内容
 	orderInfo, err := parseOrderMessage(msg)
 	if err != nil {
-		return fmt.Errorf("解析消息失败: %v", err)
+		return fmt.Errorf("%w: 解析消息失败: %v", errSeckillOrderRejected, err)
 	}
 
 	// 转换字符串ID为uint
 	userID, err := strconv.ParseUint(orderInfo.UserID, 10, 32)
 	if err != nil {
-		return fmt.Errorf("解析用户ID失败: %v", err)
+		return fmt.Errorf("%w: 解析用户ID失败: %v", errSeckillOrderRejected, err)
 	}
 
 	voucherID, err := strconv.ParseUint(orderInfo.VoucherID, 10, 32)
 	if err != nil {
-		return fmt.Errorf("解析优惠券ID失败: %v", err)
+		return fmt.Errorf("%w: 解析优惠券ID失败: %v", errSeckillOrderRejected, err)
+	}
+
+	orderID, err := strconv.ParseUint(orderInfo.OrderID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: 解析订单ID失败: %v", errSeckillOrderRejected, err)
 	}
 
 	// 处理订单
-	return processStreamOrder(ctx, uint(userID), uint(voucherID), orderInfo.OrderID)
+	return processStreamOrder(ctx, uint(userID), uint(voucherID), uint(orderID))
 }
 
 // parseOrderMessage 解析订单消息
@@ -532,7 +962,20 @@ func parseOrderMessage(msg redis.XMessage) (*StreamOrderInfo, error) {
 }
 
 // processStreamOrder 处理Stream中的订单
-func processStreamOrder(ctx context.Context, userID, voucherID uint, orderID string) error {
+func processStreamOrder(ctx context.Context, userID, voucherID, orderID uint) error {
+	// 消息可能因为未及时ACK而被重复投递，订单已存在时直接视为处理成功
+	if existing, err := dao.GetVoucherOrderByID(ctx, dao.DB, orderID); err == nil {
+		log.Printf("订单已存在，跳过重复消息: orderID=%d", orderID)
+		markSeckillOrderStatus(ctx, orderID, dao.SeckillOrderCreated, "")
+		// 上次处理可能在写入延迟队列之前中断，重新加入（已存在时不会重复添加）
+		if existing.Status == models.OrderStatusUnpaid {
+			scheduleOrderPayTimeout(ctx, existing)
+		}
+		return nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("查询订单失败: %v", err)
+	}
+
 	// 开始数据库事务
 	tx := dao.DB.Begin()
 	if tx.Error != nil {
@@ -546,26 +989,37 @@ func processStreamOrder(ctx context.Context, userID, voucherID uint, orderID str
 		}
 	}()
 
-	// 创建订单
+	// 扣减数据库库存（乐观锁），与创建订单在同一事务中，保证MySQL库存与订单数一致
+	if err := dao.UpdateSeckillVoucherStock(ctx, tx, voucherID, 1); err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: 数据库库存不足: voucherID=%d", errSeckillOrderRejected, voucherID)
+		}
+		return fmt.Errorf("扣减库存失败: %v", err)
+	}
+
+	// 分配购买序号，序号已占满说明超出每人限购数量
+	seq, err := nextSeckillOrderSeq(ctx, tx, userID, voucherID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// 创建订单，使用秒杀时生成的订单ID作为主键
 	now := time.Now()
 	order := &models.VoucherOrder{
+		ID:          orderID,
 		UserID:      userID,
 		VoucherID:   voucherID,
 		PayType:     1,
-		Status:      1,
+		Status:      models.OrderStatusUnpaid,
 		CreateTime:  &now,
 		VoucherType: 2, // 秒杀券类型
+		SeckillKey:  dao.SeckillOrderKey(userID, voucherID, seq),
 	}
 
-	// 如果Lua脚本提供了订单ID，可以使用它
-	if orderID != "" {
-		// 这里可以根据需要设置订单ID或其他字段
-		// 注意：GORM的ID字段通常是自增的，需要根据实际情况处理
-	}
-
-	// 创建订单记录
-	err := dao.CreateVoucherOrder(ctx, tx, order)
-	if err != nil {
+	// 创建订单记录，唯一索引 uk_seckill_user_voucher 兜底每人限购
+	if err := dao.CreateVoucherOrder(ctx, tx, order); err != nil {
 		tx.Rollback()
 		return fmt.Errorf("创建订单失败: %v", err)
 	}
@@ -579,17 +1033,88 @@ func processStreamOrder(ctx context.Context, userID, voucherID uint, orderID str
 	log.Printf("成功创建订单: userID=%d, voucherID=%d, orderID=%d",
 		userID, voucherID, order.ID)
 
+	markSeckillOrderStatus(ctx, orderID, dao.SeckillOrderCreated, "")
+
+	// 加入支付超时延迟队列，超时未支付自动取消
+	scheduleOrderPayTimeout(ctx, order)
+
 	return nil
 }
 
+// nextSeckillOrderSeq 获取用户在该秒杀券下最小的未占用购买序号
+// 并发下两个订单可能拿到同一序号，唯一索引会拒绝其中一个，失败的消息重试时会分配到下一个序号
+func nextSeckillOrderSeq(ctx context.Context, tx *gorm.DB, userID, voucherID uint) (int, error) {
+	var seckillVoucher models.SeckillVoucher
+	if err := tx.WithContext(ctx).Select("limit_per_user").Where("voucher_id = ?", voucherID).First(&seckillVoucher).Error; err != nil {
+		return 0, fmt.Errorf("查询秒杀券失败: %v", err)
+	}
+	limit := seckillVoucher.LimitPerUser
+	if limit <= 0 {
+		limit = 1
+	}
+
+	keys, err := dao.GetUserSeckillOrderKeys(ctx, tx, userID, voucherID)
+	if err != nil {
+		return 0, fmt.Errorf("查询用户已购订单失败: %v", err)
+	}
+	used := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		used[key] = true
+	}
+
+	for seq := 1; seq <= limit; seq++ {
+		if !used[*dao.SeckillOrderKey(userID, voucherID, seq)] {
+			return seq, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: 超出每人限购数量: userID=%d, voucherID=%d, limit=%d", errSeckillOrderRejected, userID, voucherID, limit)
+}
+
+// markSeckillOrderStatus 更新Redis中的订单处理状态，失败只记录日志，不影响订单处理结果
+func markSeckillOrderStatus(ctx context.Context, orderID uint, status, reason string) {
+	if err := dao.SetSeckillOrderStatus(ctx, dao.Redis, orderID, status, reason); err != nil {
+		log.Printf("更新订单处理状态失败: orderID=%d, status=%s, error=%v", orderID, status, err)
+	}
+}
+
 // StopStreamConsumers 停止所有Stream消费者（用于优雅关闭）
 func StopStreamConsumers() {
 	log.Println("正在停止Stream消费者...")
 	close(stopChan)
 	wg.Wait()
+	removeConsumers(context.Background())
 	log.Println("所有Stream消费者已停止")
 }
 
+// removeConsumers 从消费者组中删除当前进程的消费者
+// 仍有pending消息的消费者不能删除（否则消息会丢失），保留给其他实例认领
+func removeConsumers(ctx context.Context) {
+	infos, err := dao.Redis.XInfoConsumers(ctx, streamKey, groupName).Result()
+	if err != nil {
+		log.Printf("获取消费者信息失败: %v", err)
+		return
+	}
+
+	pending := make(map[string]int64, len(infos))
+	for _, info := range infos {
+		pending[info.Name] = info.Pending
+	}
+
+	for _, name := range consumerNames {
+		count, ok := pending[name]
+		if !ok {
+			continue
+		}
+		if count > 0 {
+			log.Printf("消费者 %s 仍有 %d 条pending消息，保留等待其他实例认领", name, count)
+			continue
+		}
+		if err := dao.Redis.XGroupDelConsumer(ctx, streamKey, groupName, name).Err(); err != nil {
+			log.Printf("删除消费者 %s 失败: %v", name, err)
+		}
+	}
+}
+
 // GetStreamInfo 获取Stream状态信息（用于监控）
 func GetStreamInfo() (map[string]interface{}, error) {
 	ctx := context.Background()
@@ -618,3 +1143,204 @@ func GetStreamInfo() (map[string]interface{}, error) {
 		"consumers": consumerInfo,
 	}, nil
 }
+
+// GetVoucherOrder 查询订单详情及异步处理结果（pending/created/failed）
+func GetVoucherOrder(ctx context.Context, userId, orderId uint) *utils.Result {
+	orderIdStr := strconv.FormatUint(uint64(orderId), 10)
+
+	// 1. 订单已落库，直接返回订单详情
+	order, err := dao.GetVoucherOrderByID(ctx, dao.DB, orderId)
+	if err == nil {
+		if order.UserID != userId {
+			return utils.ErrorResult("订单不存在")
+		}
+		return utils.SuccessResultWithData(map[string]interface{}{
+			"orderId": orderIdStr,
+			"status":  dao.SeckillOrderCreated,
+			"order":   order,
+		})
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("查询订单失败: orderId=%d, error=%v", orderId, err)
+		return utils.ErrorResult("系统错误")
+	}
+
+	// 2. 订单尚未落库，查询Redis中的处理状态
+	status, err := dao.GetSeckillOrderStatus(ctx, dao.Redis, orderId)
+	if err != nil {
+		log.Printf("查询订单处理状态失败: orderId=%d, error=%v", orderId, err)
+		return utils.ErrorResult("系统错误")
+	}
+	if status == nil || status.UserID != userId {
+		return utils.ErrorResult("订单不存在")
+	}
+
+	return utils.SuccessResultWithData(map[string]interface{}{
+		"orderId":   orderIdStr,
+		"status":    status.Status,
+		"voucherId": status.VoucherID,
+		"reason":    status.Reason,
+	})
+}
+
+// GetMyVoucherOrders 获取当前用户的订单列表
+func GetMyVoucherOrders(ctx context.Context, userId uint, page, size int) *utils.Result {
+	page, size = utils.NormalizePage(page, size)
+	orders, err := dao.GetVoucherOrdersByUser(ctx, dao.DB, userId, page, size)
+	if err != nil {
+		return utils.ErrorResult("查询失败")
+	}
+
+	total, err := dao.CountVoucherOrdersByUser(ctx, dao.DB, userId)
+	if err != nil {
+		return utils.ErrorResult("查询失败")
+	}
+
+	return utils.SuccessResultWithData(map[string]interface{}{
+		"list":  orders,
+		"total": total,
+		"page":  page,
+		"size":  size,
+	})
+}
+
+// ListDeadLetters 查看死信队列中的消息
+func ListDeadLetters(ctx context.Context, count int64) *utils.Result {
+	messages, err := dao.Redis.XRangeN(ctx, deadLetterKey, "-", "+", count).Result()
+	if err != nil {
+		log.Printf("查询死信队列失败: %v", err)
+		return utils.ErrorResult("查询死信队列失败")
+	}
+
+	total, err := dao.Redis.XLen(ctx, deadLetterKey).Result()
+	if err != nil {
+		log.Printf("查询死信队列长度失败: %v", err)
+		return utils.ErrorResult("查询死信队列失败")
+	}
+
+	list := make([]map[string]interface{}, 0, len(messages))
+	for _, msg := range messages {
+		list = append(list, map[string]interface{}{
+			"id":     msg.ID,
+			"values": msg.Values,
+		})
+	}
+
+	return utils.SuccessResultWithData(map[string]interface{}{
+		"list":  list,
+		"total": total,
+	})
+}
+
+// ReplayDeadLetter 将死信消息重新投递到订单Stream
+func ReplayDeadLetter(ctx context.Context, id string) *utils.Result {
+	msg, err := getDeadLetter(ctx, id)
+	if err != nil {
+		log.Printf("查询死信消息失败: id=%s, error=%v", id, err)
+		return utils.ErrorResult("系统错误")
+	}
+	if msg == nil {
+		return utils.ErrorResult("死信消息不存在")
+	}
+
+	// 已补偿的消息库存和购买资格都已释放，需要重新走秒杀脚本抢占资格
+	if msg.Values["compensated"] == "1" {
+		return replayCompensatedDeadLetter(ctx, msg)
+	}
+
+	pipe := dao.Redis.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		ID:     "*",
+		Values: map[string]interface{}{
+			"userId":    msg.Values["userId"],
+			"voucherId": msg.Values["voucherId"],
+			"id":        msg.Values["id"],
+		},
+	})
+	pipe.XDel(ctx, deadLetterKey, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("重新投递死信消息失败: id=%s, error=%v", id, err)
+		return utils.ErrorResult("重新投递失败")
+	}
+
+	if orderID, err := strconv.ParseUint(fmt.Sprint(msg.Values["id"]), 10, 64); err == nil {
+		markSeckillOrderStatus(ctx, uint(orderID), dao.SeckillOrderPending, "")
+	}
+
+	return utils.SuccessResult("重新投递成功")
+}
+
+// replayCompensatedDeadLetter 使用原订单ID重新执行秒杀脚本，重新预扣库存并写入订单Stream
+func replayCompensatedDeadLetter(ctx context.Context, msg *redis.XMessage) *utils.Result {
+	userID, err := strconv.ParseUint(fmt.Sprint(msg.Values["userId"]), 10, 32)
+	if err != nil {
+		return utils.ErrorResult("死信消息中的用户ID无效")
+	}
+	voucherID, err := strconv.ParseUint(fmt.Sprint(msg.Values["voucherId"]), 10, 32)
+	if err != nil {
+		return utils.ErrorResult("死信消息中的优惠券ID无效")
+	}
+	orderID, err := strconv.ParseUint(fmt.Sprint(msg.Values["id"]), 10, 64)
+	if err != nil {
+		return utils.ErrorResult("死信消息中的订单ID无效")
+	}
+
+	// 秒杀结束后也允许重新投递，库存、限购和上下架仍按当前状态校验
+	r, err := runSeckillScript(ctx, uint(voucherID), uint(userID), uint(orderID), true)
+	if err != nil {
+		log.Printf("重新执行秒杀脚本失败: id=%s, error=%v", msg.ID, err)
+		return utils.ErrorResult("系统错误")
+	}
+	if r != seckillSuccess {
+		return utils.ErrorResult("重新投递失败: " + seckillFailMessage(r))
+	}
+
+	// 清除补偿标记，订单再次失败时可以重新补偿
+	pipe := dao.Redis.TxPipeline()
+	pipe.Del(ctx, compensatedKeyPrefix+strconv.FormatUint(orderID, 10))
+	pipe.XDel(ctx, deadLetterKey, msg.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("清理死信消息失败: id=%s, error=%v", msg.ID, err)
+	}
+
+	return utils.SuccessResult("重新投递成功")
+}
+
+// DiscardDeadLetter 丢弃死信消息，未完成库存补偿的消息会先进行补偿
+func DiscardDeadLetter(ctx context.Context, id string) *utils.Result {
+	msg, err := getDeadLetter(ctx, id)
+	if err != nil {
+		log.Printf("查询死信消息失败: id=%s, error=%v", id, err)
+		return utils.ErrorResult("系统错误")
+	}
+	if msg == nil {
+		return utils.ErrorResult("死信消息不存在")
+	}
+
+	// 内容无法解析的消息无从补偿，直接丢弃
+	if msg.Values["compensated"] != "1" {
+		if err := compensateFromMessage(ctx, msg.Values, "discard"); err != nil && !errors.Is(err, errInvalidOrderMessage) {
+			log.Printf("死信消息库存补偿失败: id=%s, error=%v", id, err)
+			return utils.ErrorResult("库存补偿失败，请稍后重试")
+		}
+	}
+
+	if err := dao.Redis.XDel(ctx, deadLetterKey, id).Err(); err != nil {
+		log.Printf("删除死信消息失败: id=%s, error=%v", id, err)
+		return utils.ErrorResult("系统错误")
+	}
+	return utils.SuccessResult("丢弃成功")
+}
+
+// getDeadLetter 根据ID获取死信消息，不存在时返回 nil, nil
+func getDeadLetter(ctx context.Context, id string) (*redis.XMessage, error) {
+	messages, err := dao.Redis.XRange(ctx, deadLetterKey, id, id).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+	return &messages[0], nil
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int64
+		want     time.Duration
+	}{
+		{0, minRetryBackoff},
+		{1, minRetryBackoff},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{5, 16 * time.Second},
+		{6, maxRetryBackoff},
+		{100, maxRetryBackoff},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("已投递%d次", tt.attempts), func(t *testing.T) {
+			if got := retryBackoff(tt.attempts); got != tt.want {
+				t.Errorf("retryBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeckillOrderRejectedIsDistinguishable(t *testing.T) {
+	rejected := fmt.Errorf("%w: 数据库库存不足: voucherID=%d", errSeckillOrderRejected, 1)
+	transient := fmt.Errorf("扣减库存失败: %v", errors.New("connection refused"))
+
+	if !errors.Is(rejected, errSeckillOrderRejected) {
+		t.Error("无法创建的订单应转入死信队列")
+	}
+	if errors.Is(transient, errSeckillOrderRejected) {
+		t.Error("瞬时错误不应转入死信队列")
+	}
+}
@@ -2,9 +2,11 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"hm-dianping-go/dao"
 	"hm-dianping-go/models"
 	"hm-dianping-go/utils"
+	"log"
 	"time"
 )
 
@@ -19,21 +21,74 @@ func GetVoucherList(shopId uint) *utils.Result {
 	return utils.SuccessResultWithData(vouchers)
 }
 
+// AddVoucherRequest 添加普通券请求结构
+type AddVoucherRequest struct {
+	ShopID      uint       `json:"shopId" binding:"required"`
+	Title       string     `json:"title" binding:"required"`
+	SubTitle    string     `json:"subTitle"`
+	Rules       string     `json:"rules"`
+	PayValue    int64      `json:"payValue" binding:"required,min=1"`
+	ActualValue int64      `json:"actualValue" binding:"required,min=1"`
+	Stock       int        `json:"stock" binding:"required,min=1"`
+	BeginTime   *time.Time `json:"beginTime"` // 不传表示立即生效
+	EndTime     *time.Time `json:"endTime"`   // 不传表示长期有效
+}
+
+// AddVoucher 商家添加普通券
+func AddVoucher(ctx context.Context, userId uint, req *AddVoucherRequest) *utils.Result {
+	if res := checkShopManager(ctx, userId, req.ShopID); res != nil {
+		return res
+	}
+	if req.BeginTime != nil && req.EndTime != nil && req.EndTime.Before(*req.BeginTime) {
+		return utils.ErrorResult("结束时间不能早于开始时间")
+	}
+
+	voucher := &models.Voucher{
+		ShopID:      req.ShopID,
+		Title:       req.Title,
+		SubTitle:    req.SubTitle,
+		Rules:       req.Rules,
+		PayValue:    req.PayValue,
+		ActualValue: req.ActualValue,
+		Type:        0, // 0-普通券
+		Status:      1, // 1-上架
+		Stock:       req.Stock,
+		BeginTime:   req.BeginTime,
+		EndTime:     req.EndTime,
+	}
+	if err := dao.DB.WithContext(ctx).Create(voucher).Error; err != nil {
+		return utils.ErrorResult("创建优惠券失败")
+	}
+
+	addVoucherToBloomFilter(ctx, voucher.ID)
+
+	return utils.SuccessResultWithData(map[string]interface{}{
+		"voucherId": voucher.ID,
+		"message":   "优惠券创建成功",
+	})
+}
+
 // AddSeckillVoucherRequest 添加秒杀券请求结构
 type AddSeckillVoucherRequest struct {
-	ShopID      uint      `json:"shopId" binding:"required"`
-	Title       string    `json:"title" binding:"required"`
-	SubTitle    string    `json:"subTitle"`
-	Rules       string    `json:"rules"`
-	PayValue    int64     `json:"payValue" binding:"required"`
-	ActualValue int64     `json:"actualValue" binding:"required"`
-	Stock       int       `json:"stock" binding:"required,min=1"`
-	BeginTime   time.Time `json:"beginTime" binding:"required"`
-	EndTime     time.Time `json:"endTime" binding:"required"`
+	ShopID       uint      `json:"shopId" binding:"required"`
+	Title        string    `json:"title" binding:"required"`
+	SubTitle     string    `json:"subTitle"`
+	Rules        string    `json:"rules"`
+	PayValue     int64     `json:"payValue" binding:"required"`
+	ActualValue  int64     `json:"actualValue" binding:"required"`
+	Stock        int       `json:"stock" binding:"required,min=1"`
+	LimitPerUser int       `json:"limitPerUser" binding:"omitempty,min=1"` // 每人限购数量，不传时默认为1
+	Queued       bool      `json:"queued"`                                 // 是否需要排队领取购买许可，适用于大型秒杀活动
+	BeginTime    time.Time `json:"beginTime" binding:"required"`
+	EndTime      time.Time `json:"endTime" binding:"required"`
 }
 
-// AddSeckillVoucher 添加秒杀券
-func AddSeckillVoucher(ctx context.Context, req *AddSeckillVoucherRequest) *utils.Result {
+// AddSeckillVoucher 商家添加秒杀券
+func AddSeckillVoucher(ctx context.Context, userId uint, req *AddSeckillVoucherRequest) *utils.Result {
+	if res := checkShopManager(ctx, userId, req.ShopID); res != nil {
+		return res
+	}
+
 	// 验证时间逻辑
 	if req.EndTime.Before(req.BeginTime) {
 		return utils.ErrorResult("结束时间不能早于开始时间")
@@ -48,6 +103,15 @@ func AddSeckillVoucher(ctx context.Context, req *AddSeckillVoucherRequest) *util
 		return utils.ErrorResult("支付金额必须大于实际价值")
 	}
 
+	// 验证限购数量
+	limitPerUser := req.LimitPerUser
+	if limitPerUser == 0 {
+		limitPerUser = 1
+	}
+	if limitPerUser > req.Stock {
+		return utils.ErrorResult("每人限购数量不能大于库存")
+	}
+
 	// 开启事务
 	tx := dao.DB.Begin()
 	if tx.Error != nil {
@@ -81,12 +145,14 @@ func AddSeckillVoucher(ctx context.Context, req *AddSeckillVoucherRequest) *util
 
 	// 2. 创建秒杀券记录
 	seckillVoucher := &models.SeckillVoucher{
-		VoucherID:  voucher.ID,
-		Stock:      req.Stock,
-		CreateTime: time.Now(),
-		BeginTime:  req.BeginTime,
-		EndTime:    req.EndTime,
-		UpdateTime: time.Now(),
+		VoucherID:    voucher.ID,
+		Stock:        req.Stock,
+		LimitPerUser: limitPerUser,
+		Queued:       req.Queued,
+		CreateTime:   time.Now(),
+		BeginTime:    req.BeginTime,
+		EndTime:      req.EndTime,
+		UpdateTime:   time.Now(),
 	}
 
 	if err := tx.Create(seckillVoucher).Error; err != nil {
@@ -99,12 +165,18 @@ func AddSeckillVoucher(ctx context.Context, req *AddSeckillVoucherRequest) *util
 		tx.Rollback()
 		return utils.ErrorResult("创建秒杀券缓存失败")
 	}
+	if err := dao.SetSeckillVoucherMetaCache(ctx, dao.Redis, seckillVoucher); err != nil {
+		tx.Rollback()
+		return utils.ErrorResult("创建秒杀券缓存失败")
+	}
 
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
 		return utils.ErrorResult("事务提交失败")
 	}
 
+	addVoucherToBloomFilter(ctx, voucher.ID)
+
 	return utils.SuccessResultWithData(map[string]interface{}{
 		"voucherId": voucher.ID,
 		"message":   "秒杀券创建成功",
@@ -138,3 +210,65 @@ func GetSeckillVoucher(voucherID uint) *utils.Result {
 
 	return utils.SuccessResultWithData(result)
 }
+
+// WarmUpSeckillVouchers 将所有未结束秒杀券的库存和用户已购数量加载到Redis
+// Redis被清空或秒杀券直接通过SQL创建时，秒杀脚本依赖的缓存不存在，需要在启动时预热
+func WarmUpSeckillVouchers(ctx context.Context) error {
+	vouchers, err := dao.GetActiveSeckillVouchers(ctx, dao.DB, time.Now())
+	if err != nil {
+		return fmt.Errorf("查询秒杀券失败: %v", err)
+	}
+
+	// 单张秒杀券预热失败不影响其他秒杀券，失败的秒杀券汇总后返回
+	warmed := 0
+	var failed []uint
+	for i := range vouchers {
+		initialized, err := WarmUpSeckillVoucher(ctx, &vouchers[i])
+		if err != nil {
+			log.Printf("秒杀券缓存预热失败: %v", err)
+			failed = append(failed, vouchers[i].VoucherID)
+			continue
+		}
+		if initialized {
+			warmed++
+		}
+	}
+
+	log.Printf("秒杀券缓存预热完成: 未结束秒杀券=%d, 新加载=%d, 失败=%d", len(vouchers), warmed, len(failed))
+	if len(failed) > 0 {
+		return fmt.Errorf("%d 张秒杀券预热失败: %v", len(failed), failed)
+	}
+	return nil
+}
+
+// WarmUpSeckillVoucher 预热单张秒杀券，只补齐缺失的缓存，返回库存缓存是否为新加载
+func WarmUpSeckillVoucher(ctx context.Context, voucher *models.SeckillVoucher) (bool, error) {
+	counts, err := dao.GetSeckillOrderCountsByUser(ctx, dao.DB, voucher.VoucherID)
+	if err != nil {
+		return false, fmt.Errorf("查询秒杀券用户已购数量失败: voucherId=%d, error=%v", voucher.VoucherID, err)
+	}
+	if err := dao.InitSeckillVoucherPurchaseCache(ctx, dao.Redis, voucher.VoucherID, counts); err != nil {
+		return false, fmt.Errorf("预热用户已购数量失败: voucherId=%d, error=%v", voucher.VoucherID, err)
+	}
+
+	// 秒杀时间、限购数量和上下架状态以数据库为准，直接覆盖
+	if err := dao.SetSeckillVoucherMetaCache(ctx, dao.Redis, voucher); err != nil {
+		return false, fmt.Errorf("预热秒杀券元信息失败: voucherId=%d, error=%v", voucher.VoucherID, err)
+	}
+	baseVoucher, err := dao.GetVoucherByID(ctx, dao.DB, voucher.VoucherID)
+	if err != nil {
+		return false, fmt.Errorf("查询优惠券失败: voucherId=%d, error=%v", voucher.VoucherID, err)
+	}
+	if err := dao.SetSeckillVoucherStatusCache(ctx, dao.Redis, voucher.VoucherID, baseVoucher.Status); err != nil {
+		return false, fmt.Errorf("预热秒杀券状态失败: voucherId=%d, error=%v", voucher.VoucherID, err)
+	}
+
+	initialized, err := dao.InitSeckillVoucherStockCache(ctx, dao.Redis, voucher.VoucherID, voucher.Stock)
+	if err != nil {
+		return false, fmt.Errorf("预热库存失败: voucherId=%d, error=%v", voucher.VoucherID, err)
+	}
+	if initialized {
+		notifySeckillStockReplenished(ctx, voucher.VoucherID)
+	}
+	return initialized, nil
+}
@@ -0,0 +1,310 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// ErrCacheNotFound 数据不存在：布隆过滤器判断不存在、命中空值缓存或数据库中不存在
+var ErrCacheNotFound = errors.New("数据不存在")
+
+// ErrCacheBusy 等待其他请求重建缓存超时
+var ErrCacheBusy = errors.New("服务繁忙，请稍后重试")
+
+// 缓存重建相关默认配置
+const (
+	defaultCacheLockTTL     = 10 * time.Second      // 重建缓存互斥锁的过期时间
+	defaultCacheRetryWait   = 50 * time.Millisecond // 未获取到锁时等待后重新查询缓存的间隔
+	defaultCacheRetryTimes  = 10                    // 未获取到锁时最多重试次数
+	defaultCacheRebuildTime = 10 * time.Second      // 逻辑过期异步重建的超时时间
+)
+
+// CacheOptions 缓存配置
+type CacheOptions struct {
+	KeyPrefix string        // 缓存key前缀，完整key为 前缀+ID
+	TTL       time.Duration // 缓存有效期，逻辑过期模式下为逻辑过期时间
+	NullTTL   time.Duration // 空值缓存有效期，用于防止缓存穿透，为0时不缓存空值
+	LockTTL   time.Duration // 重建缓存互斥锁的过期时间，为0时使用默认值
+	BloomKey  string        // 布隆过滤器key，不为空时先经过布隆过滤器判断数据是否存在
+}
+
+// CacheLoader 缓存未命中时从数据库加载数据，数据不存在时返回 gorm.ErrRecordNotFound 或 ErrCacheNotFound
+type CacheLoader[K comparable, T any] func(ctx context.Context, id K) (T, error)
+
+// CacheClient 通用缓存客户端，封装缓存穿透、缓存击穿的常用解决方案
+// K 为数据ID类型，T 为缓存的数据类型，数据以JSON格式存储
+type CacheClient[K comparable, T any] struct {
+	rds  *redis.Client
+	opts CacheOptions
+}
+
+// logicalExpireData 逻辑过期模式下缓存的数据，Data 为空表示数据不存在
+type logicalExpireData[T any] struct {
+	Data       *T        `json:"data"`
+	ExpireTime time.Time `json:"expireTime"`
+}
+
+// NewCacheClient 创建缓存客户端
+func NewCacheClient[K comparable, T any](rds *redis.Client, opts CacheOptions) *CacheClient[K, T] {
+	if opts.LockTTL <= 0 {
+		opts.LockTTL = defaultCacheLockTTL
+	}
+	return &CacheClient[K, T]{rds: rds, opts: opts}
+}
+
+// Key 获取数据的缓存key
+func (c *CacheClient[K, T]) Key(id K) string {
+	return fmt.Sprintf("%s%v", c.opts.KeyPrefix, id)
+}
+
+// lockKey 获取重建缓存的互斥锁key
+func (c *CacheClient[K, T]) lockKey(id K) string {
+	return "lock:" + c.Key(id)
+}
+
+// Set 写入缓存，使用配置的有效期
+func (c *CacheClient[K, T]) Set(ctx context.Context, id K, value T) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("序列化缓存数据失败: %w", err)
+	}
+	return c.rds.Set(ctx, c.Key(id), data, c.opts.TTL).Err()
+}
+
+// SetWithLogicalExpire 写入逻辑过期缓存，key本身不过期，由读取时判断逻辑过期时间
+func (c *CacheClient[K, T]) SetWithLogicalExpire(ctx context.Context, id K, value T) error {
+	return c.setLogical(ctx, id, &value)
+}
+
+// Delete 删除缓存
+func (c *CacheClient[K, T]) Delete(ctx context.Context, id K) error {
+	return c.rds.Del(ctx, c.Key(id)).Err()
+}
+
+// QueryWithPassThrough 查询数据，使用布隆过滤器和空值缓存解决缓存穿透
+func (c *CacheClient[K, T]) QueryWithPassThrough(ctx context.Context, id K, loader CacheLoader[K, T]) (T, error) {
+	var zero T
+	if !c.mightExist(ctx, id) {
+		return zero, ErrCacheNotFound
+	}
+
+	// 1. 查询缓存
+	value, hit, err := c.get(ctx, id)
+	if hit || err != nil {
+		return value, err
+	}
+
+	// 2. 缓存未命中，查询数据库并写入缓存
+	return c.load(ctx, id, loader)
+}
+
+// QueryWithMutex 查询数据，在 QueryWithPassThrough 的基础上使用互斥锁解决缓存击穿
+// 同一时间只有一个请求查询数据库重建缓存，其他请求等待后重新查询缓存
+func (c *CacheClient[K, T]) QueryWithMutex(ctx context.Context, id K, loader CacheLoader[K, T]) (T, error) {
+	var zero T
+	if !c.mightExist(ctx, id) {
+		return zero, ErrCacheNotFound
+	}
+
+	for i := 0; i < defaultCacheRetryTimes; i++ {
+		// 1. 查询缓存
+		value, hit, err := c.get(ctx, id)
+		if hit || err != nil {
+			return value, err
+		}
+
+		// 2. 缓存未命中，获取互斥锁，获取失败时等待其他请求重建缓存
+		ok, lockValue := TryLockWithTTL(ctx, c.rds, c.lockKey(id), c.opts.LockTTL)
+		if !ok {
+			time.Sleep(defaultCacheRetryWait)
+			continue
+		}
+
+		// 3. 获取锁成功后再次检查缓存（双重检查），未命中时查询数据库重建缓存
+		value, hit, err = c.get(ctx, id)
+		if !hit && err == nil {
+			value, err = c.load(ctx, id, loader)
+		}
+		UnLockSafe(ctx, c.rds, c.lockKey(id), lockValue)
+		return value, err
+	}
+	return zero, ErrCacheBusy
+}
+
+// QueryWithLogicalExpire 查询数据，使用逻辑过期解决缓存击穿，适用于热点数据
+// 缓存逻辑过期后返回旧数据，由获取到互斥锁的请求异步重建缓存；缓存不存在时同步加载
+func (c *CacheClient[K, T]) QueryWithLogicalExpire(ctx context.Context, id K, loader CacheLoader[K, T]) (T, error) {
+	var zero T
+	if !c.mightExist(ctx, id) {
+		return zero, ErrCacheNotFound
+	}
+
+	for i := 0; i < defaultCacheRetryTimes; i++ {
+		// 1. 查询缓存
+		cached, err := c.getLogical(ctx, id)
+		if err != nil {
+			return zero, err
+		}
+
+		// 2. 缓存未过期，直接返回
+		if cached != nil && time.Now().Before(cached.ExpireTime) {
+			return cached.value()
+		}
+
+		// 3. 缓存不存在或已过期，获取互斥锁
+		ok, lockValue := TryLockWithTTL(ctx, c.rds, c.lockKey(id), c.opts.LockTTL)
+		if !ok {
+			// 其他请求正在重建缓存，已有旧数据时直接返回旧数据
+			if cached != nil {
+				return cached.value()
+			}
+			time.Sleep(defaultCacheRetryWait)
+			continue
+		}
+
+		// 4. 缓存不存在时同步加载
+		if cached == nil {
+			value, err := c.rebuildLogical(ctx, id, loader)
+			UnLockSafe(ctx, c.rds, c.lockKey(id), lockValue)
+			return value, err
+		}
+
+		// 5. 缓存已过期，异步重建并返回旧数据
+		go func() {
+			rebuildCtx, cancel := context.WithTimeout(context.Background(), defaultCacheRebuildTime)
+			defer cancel()
+			defer UnLockSafe(rebuildCtx, c.rds, c.lockKey(id), lockValue)
+			if _, err := c.rebuildLogical(rebuildCtx, id, loader); err != nil && !errors.Is(err, ErrCacheNotFound) {
+				log.Printf("重建缓存失败: key=%s, error=%v", c.Key(id), err)
+			}
+		}()
+		return cached.value()
+	}
+	return zero, ErrCacheBusy
+}
+
+// mightExist 使用布隆过滤器判断数据是否可能存在，未配置或检查失败时视为可能存在
+func (c *CacheClient[K, T]) mightExist(ctx context.Context, id K) bool {
+	if c.opts.BloomKey == "" {
+		return true
+	}
+	exists, err := CheckStringExistsInBloomFilter(ctx, c.rds, c.opts.BloomKey, fmt.Sprint(id))
+	if err != nil {
+		log.Printf("检查布隆过滤器失败: key=%s, error=%v", c.opts.BloomKey, err)
+		return true
+	}
+	return exists
+}
+
+// get 查询缓存，hit 表示缓存命中（包括命中空值缓存，此时返回 ErrCacheNotFound）
+func (c *CacheClient[K, T]) get(ctx context.Context, id K) (value T, hit bool, err error) {
+	data, err := c.rds.Get(ctx, c.Key(id)).Result()
+	if errors.Is(err, redis.Nil) {
+		return value, false, nil
+	}
+	if err != nil {
+		// 缓存异常时查询数据库，不影响业务
+		log.Printf("查询缓存失败: key=%s, error=%v", c.Key(id), err)
+		return value, false, nil
+	}
+	if data == "" {
+		return value, true, ErrCacheNotFound
+	}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		// 缓存数据损坏时按未命中处理，重新加载后覆盖
+		log.Printf("解析缓存数据失败: key=%s, error=%v", c.Key(id), err)
+		return value, false, nil
+	}
+	return value, true, nil
+}
+
+// load 查询数据库并写入缓存，数据不存在时写入空值缓存
+func (c *CacheClient[K, T]) load(ctx context.Context, id K, loader CacheLoader[K, T]) (T, error) {
+	value, err := loader(ctx, id)
+	if isCacheNotFound(err) {
+		if c.opts.NullTTL > 0 {
+			if err := c.rds.Set(ctx, c.Key(id), "", c.opts.NullTTL).Err(); err != nil {
+				log.Printf("写入空值缓存失败: key=%s, error=%v", c.Key(id), err)
+			}
+		}
+		return value, ErrCacheNotFound
+	}
+	if err != nil {
+		return value, err
+	}
+
+	if err := c.Set(ctx, id, value); err != nil {
+		log.Printf("写入缓存失败: key=%s, error=%v", c.Key(id), err)
+	}
+	return value, nil
+}
+
+// getLogical 查询逻辑过期缓存，缓存不存在时返回 nil
+func (c *CacheClient[K, T]) getLogical(ctx context.Context, id K) (*logicalExpireData[T], error) {
+	data, err := c.rds.Get(ctx, c.Key(id)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询缓存失败: %w", err)
+	}
+	var cached logicalExpireData[T]
+	if err := json.Unmarshal([]byte(data), &cached); err != nil {
+		log.Printf("解析缓存数据失败: key=%s, error=%v", c.Key(id), err)
+		return nil, nil
+	}
+	return &cached, nil
+}
+
+// rebuildLogical 查询数据库并写入逻辑过期缓存，数据不存在时同样写入，避免反复查询数据库
+func (c *CacheClient[K, T]) rebuildLogical(ctx context.Context, id K, loader CacheLoader[K, T]) (T, error) {
+	value, err := loader(ctx, id)
+	if err != nil && !isCacheNotFound(err) {
+		return value, err
+	}
+
+	var data *T
+	if err == nil {
+		data = &value
+	}
+	if err := c.setLogical(ctx, id, data); err != nil {
+		log.Printf("写入缓存失败: key=%s, error=%v", c.Key(id), err)
+	}
+	if data == nil {
+		return value, ErrCacheNotFound
+	}
+	return value, nil
+}
+
+// setLogical 写入逻辑过期缓存
+func (c *CacheClient[K, T]) setLogical(ctx context.Context, id K, value *T) error {
+	data, err := json.Marshal(logicalExpireData[T]{
+		Data:       value,
+		ExpireTime: time.Now().Add(c.opts.TTL),
+	})
+	if err != nil {
+		return fmt.Errorf("序列化缓存数据失败: %w", err)
+	}
+	return c.rds.Set(ctx, c.Key(id), data, 0).Err()
+}
+
+// value 获取逻辑过期缓存中的数据
+func (d *logicalExpireData[T]) value() (T, error) {
+	if d.Data == nil {
+		var zero T
+		return zero, ErrCacheNotFound
+	}
+	return *d.Data, nil
+}
+
+// isCacheNotFound 判断加载结果是否表示数据不存在
+func isCacheNotFound(err error) bool {
+	return errors.Is(err, ErrCacheNotFound) || errors.Is(err, gorm.ErrRecordNotFound)
+}
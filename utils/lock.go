@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"hm-dianping-go/script"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -80,20 +81,12 @@ func UnLock(ctx context.Context, rds *redis.Client, key string) {
 // UnLockSafe 安全释放锁（检查锁值）
 func UnLockSafe(ctx context.Context, rds *redis.Client, key, value string) bool {
 	// Lua脚本确保原子性删除
-	luaScript := `
-		if redis.call("get", KEYS[1]) == ARGV[1] then
-			return redis.call("del", KEYS[1])
-		else
-			return 0
-		end
-	`
-
-	result, err := rds.Eval(ctx, luaScript, []string{key}, value).Result()
+	result, err := script.Unlock.Run(ctx, rds, []string{key}, value).Int()
 	if err != nil {
 		return false
 	}
 
-	return result.(int64) == 1
+	return result == 1
 }
 
 // UnLock 释放锁
@@ -104,18 +97,10 @@ func (dl *DistributedLock) UnLock(ctx context.Context) bool {
 // Refresh 刷新锁的TTL
 func (dl *DistributedLock) Refresh(ctx context.Context) bool {
 	// Lua脚本确保原子性刷新TTL
-	luaScript := `
-		if redis.call("get", KEYS[1]) == ARGV[1] then
-			return redis.call("expire", KEYS[1], ARGV[2])
-		else
-			return 0
-		end
-	`
-
-	result, err := dl.redisClient.Eval(ctx, luaScript, []string{dl.key}, dl.value, int(dl.ttl.Seconds())).Result()
+	result, err := script.RefreshLock.Run(ctx, dl.redisClient, []string{dl.key}, dl.value, int(dl.ttl.Seconds())).Int()
 	if err != nil {
 		return false
 	}
 
-	return result.(int64) == 1
+	return result == 1
 }
@@ -3,6 +3,7 @@ package utils
 import (
 	"context"
 	"fmt"
+	"hm-dianping-go/config"
 	"hm-dianping-go/dao"
 	"net/http"
 	"strings"
@@ -76,6 +77,19 @@ func JWTMiddleware() gin.HandlerFunc {
 	}
 }
 
+// AdminMiddleware 管理员权限中间件，需要在JWTMiddleware之后使用
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists || !config.GetConfig().Admin.IsAdmin(userID.(uint)) {
+			ErrorResponse(c, http.StatusForbidden, "无权限访问")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 // RecoveryMiddleware 恢复中间件
 func RecoveryMiddleware() gin.HandlerFunc {
 	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
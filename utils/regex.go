@@ -18,6 +18,8 @@ const (
 	PasswordRegex = `^\w{4,32}$`
 	// VerifyCodeRegex 验证码正则, 6位数字或字母
 	VerifyCodeRegex = `^[a-zA-Z\d]{6}$`
+	// OpenHoursRegex 营业时间正则，HH:MM-HH:MM，结束时间可以为24:00
+	OpenHoursRegex = `^([01]\d|2[0-3]):[0-5]\d-(([01]\d|2[0-3]):[0-5]\d|24:00)$`
 )
 
 // 预编译正则表达式以提高性能
@@ -26,6 +28,7 @@ var (
 	emailRegexp      = regexp.MustCompile(EmailRegex)
 	passwordRegexp   = regexp.MustCompile(PasswordRegex)
 	verifyCodeRegexp = regexp.MustCompile(VerifyCodeRegex)
+	openHoursRegexp  = regexp.MustCompile(OpenHoursRegex)
 )
 
 // IsPhoneInvalid 是否是无效手机格式
@@ -56,6 +59,13 @@ func IsCodeInvalid(code string) bool {
 	return mismatch(code, verifyCodeRegexp)
 }
 
+// IsOpenHoursInvalid 是否是无效营业时间格式
+// openHours: 要校验的营业时间
+// 返回 true: 不符合，false: 符合
+func IsOpenHoursInvalid(openHours string) bool {
+	return mismatch(openHours, openHoursRegexp)
+}
+
 // IsPhoneValid 是否是有效手机格式
 // phone: 要校验的手机号
 // 返回 true: 符合，false: 不符合
@@ -74,4 +74,24 @@ func PageResult(c *gin.Context, data interface{}, total int64, page, size int) {
 			"size":  size,
 		},
 	})
-}
\ No newline at end of file
+}
+
+// 分页参数默认值
+const (
+	DefaultPageSize = 10 // 默认每页数量
+	MaxPageSize     = 50 // 每页最大数量
+)
+
+// NormalizePage 校正分页参数：页码最小为1，每页数量不合法时使用默认值，超过上限时取上限
+func NormalizePage(page, size int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 {
+		size = DefaultPageSize
+	}
+	if size > MaxPageSize {
+		size = MaxPageSize
+	}
+	return page, size
+}
@@ -0,0 +1,30 @@
+package utils
+
+import "testing"
+
+func TestNormalizePage(t *testing.T) {
+	tests := []struct {
+		name               string
+		page, size         int
+		wantPage, wantSize int
+	}{
+		{"合法参数保持不变", 3, 20, 3, 20},
+		{"页码为0", 0, 20, 1, 20},
+		{"页码为负数", -5, 20, 1, 20},
+		{"每页数量为0使用默认值", 1, 0, 1, DefaultPageSize},
+		{"每页数量为负数使用默认值", 1, -1, 1, DefaultPageSize},
+		{"每页数量等于上限", 1, MaxPageSize, 1, MaxPageSize},
+		{"每页数量超过上限取上限", 1, MaxPageSize + 1, 1, MaxPageSize},
+		{"每页数量极大", 2, 1 << 30, 2, MaxPageSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, size := NormalizePage(tt.page, tt.size)
+			if page != tt.wantPage || size != tt.wantSize {
+				t.Errorf("NormalizePage(%d, %d) = (%d, %d), want (%d, %d)",
+					tt.page, tt.size, page, size, tt.wantPage, tt.wantSize)
+			}
+		})
+	}
+}